@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"snippetbox.opre.net/internal/models"
+	"snippetbox.opre.net/internal/syntax"
+)
+
+// JSON representation of a snippet returned by the API
+type apiSnippet struct {
+	Slug       string     `json:"slug"`
+	Author     string     `json:"author"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Language   string     `json:"language"`
+	Visibility string     `json:"visibility"`
+	Protected  bool       `json:"protected"`
+	ViewsLeft  int        `json:"views_left"`
+	Tags       []string   `json:"tags"`
+	Created    time.Time  `json:"created"`
+	Expires    *time.Time `json:"expires"` // null for snippets that never expire
+}
+
+func newAPISnippet(snippet *models.Snippet) apiSnippet {
+	tags := snippet.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var expires *time.Time
+	if !snippet.Expires.IsZero() {
+		expires = &snippet.Expires
+	}
+
+	return apiSnippet{
+		Slug:       snippet.Slug,
+		Author:     snippet.Author,
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Visibility: snippet.Visibility,
+		Protected:  snippet.Protected,
+		ViewsLeft:  snippet.ViewsLeft,
+		Tags:       tags,
+		Created:    snippet.Created,
+		Expires:    expires,
+	}
+}
+
+// JSON body accepted when creating or updating a snippet. The expiry, views
+// and password are ignored on updates, just like the HTML edit form. An empty
+// visibility means public for new snippets and leaves it unchanged on updates.
+// A bare "expires" amount is in days.
+type apiSnippetInput struct {
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	Language    string   `json:"language"`
+	Visibility  string   `json:"visibility"`
+	Password    string   `json:"password"`
+	Tags        []string `json:"tags"`
+	Expiry      string   `json:"expiry"`
+	Expires     int      `json:"expires"`
+	ExpiresUnit string   `json:"expires_unit"`
+	ExpiresAt   string   `json:"expires_at"`
+	Views       int      `json:"views"`
+}
+
+// converts the input into the HTML form type, so both share their validation
+func (input apiSnippetInput) form() snippetCreateForm {
+	return snippetCreateForm{
+		Title:       input.Title,
+		Content:     input.Content,
+		Language:    input.Language,
+		Visibility:  input.Visibility,
+		Password:    input.Password,
+		Tags:        strings.Join(input.Tags, ","),
+		Expiry:      input.Expiry,
+		Expires:     input.Expires,
+		ExpiresUnit: input.ExpiresUnit,
+		ExpiresAt:   input.ExpiresAt,
+		Views:       input.Views,
+	}
+}
+
+// Shape of every error response sent by the API
+type apiError struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// List unexpired public snippets, a page at a time
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	page := newPagination(r, snippetsPageSize)
+
+	total, err := app.snippets.Count()
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	page.Total = total
+
+	snippets, err := app.snippets.List(page.PageSize, page.Offset())
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	result := []apiSnippet{}
+	for _, snippet := range snippets {
+		listed := newAPISnippet(snippet)
+
+		// the API can't unlock protected snippets and listing mustn't use up
+		// views, so only owners see the content of either
+		if (snippet.Protected || snippet.ViewsLeft > 0) && snippet.UserID != app.apiUserID(r) {
+			listed.Content = ""
+		}
+
+		result = append(result, listed)
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]any{
+		"snippets": result,
+		"page": map[string]int{
+			"page":      page.Page,
+			"page_size": page.PageSize,
+			"total":     page.Total,
+			"last_page": page.LastPage(),
+		},
+	})
+}
+
+// Get a single unexpired snippet by slug, or by ID if it is public or owned
+// by the authenticated user. Password protected snippets can only be read on
+// the website, except by their owner. Reading a view limited snippet counts
+// as a view
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	param := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	snippet, _, err := app.findSnippet(param, app.apiUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, http.StatusNotFound)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	if snippet.Protected && snippet.UserID != app.apiUserID(r) {
+		app.writeJSON(w, http.StatusForbidden, apiError{Error: "This snippet is password protected"})
+		return
+	}
+
+	if snippet.ViewsLeft > 0 && snippet.UserID != app.apiUserID(r) {
+		snippet, err = app.snippets.View(snippet.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiClientError(w, http.StatusNotFound)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]any{"snippet": newAPISnippet(snippet)})
+}
+
+// Create a snippet owned by the authenticated user
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input apiSnippetInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	form := input.form()
+	if form.Visibility == "" {
+		form.Visibility = models.VisibilityPublic
+	}
+	form.validate()
+	now := time.Now()
+	expires := form.validateExpires(now, now, app.maxLifetime)
+	form.validatePassword()
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.FieldErrors)
+		return
+	}
+
+	if form.Language == "" {
+		form.Language = syntax.Detect(form.Content)
+	}
+
+	id, slug, err := app.snippets.Insert(app.apiUserID(r), form.Title, form.Content, form.Language, form.Visibility, form.Password, expires, form.Views)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.snippets.SetTags(id, parseTags(form.Tags))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// point clients at both the API resource and the page humans can read
+	location := "/api/v1/snippets/" + slug
+
+	w.Header().Set("Location", location)
+	app.writeJSON(w, http.StatusCreated, map[string]any{
+		"slug":     slug,
+		"location": location,
+		"url":      "/snippet/view/" + slug,
+	})
+}
+
+// Replace the title, content, language and tags of a snippet owned by the
+// authenticated user
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.apiOwnedSnippetID(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiSnippetInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	form := input.form()
+	if form.Visibility == "" {
+		current, err := app.snippets.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiClientError(w, http.StatusNotFound)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+		form.Visibility = current.Visibility
+	}
+	form.validate()
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.FieldErrors)
+		return
+	}
+
+	if form.Language == "" {
+		form.Language = syntax.Detect(form.Content)
+	}
+
+	err := app.snippets.Update(id, form.Title, form.Content, form.Language, form.Visibility)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.snippets.SetTags(id, parseTags(form.Tags))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, http.StatusNotFound)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]any{"snippet": newAPISnippet(snippet)})
+}
+
+// Delete a snippet owned by the authenticated user
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.apiOwnedSnippetID(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(id)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Like ownedSnippetID() but responding with JSON errors
+func (app *application) apiOwnedSnippetID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID := app.apiUserID(r)
+
+	id, err := app.snippetOwner(httprouter.ParamsFromContext(r.Context()).ByName("id"), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, http.StatusNotFound)
+		} else {
+			app.apiServerError(w, err)
+		}
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Store the authenticated API user in the request context, marking the
+// request as authenticated just like the authenticate() middleware does for
+// browser sessions
+func (app *application) withAPIUser(r *http.Request, userID int, scope string) *http.Request {
+	ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, authenticatedUserIDContextKey, userID)
+	ctx = context.WithValue(ctx, scopeContextKey, scope)
+
+	return r.WithContext(ctx)
+}
+
+// Get the ID of the user authenticated by authenticateAPI() or
+// authenticateToken(), or 0
+func (app *application) apiUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
+// Encode data as the JSON response body
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// Decode a JSON request body of at most 1MB into dst. Unknown fields and
+// trailing data are treated as errors, so typos don't go unnoticed.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("body must not be empty")
+		}
+		return err
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// Send E500 as JSON, logging the cause
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	app.errLog.Output(2, err.Error())
+
+	app.writeJSON(w, http.StatusInternalServerError, apiError{
+		Error: http.StatusText(http.StatusInternalServerError),
+	})
+}
+
+// Send a client error status as JSON
+func (app *application) apiClientError(w http.ResponseWriter, status int) {
+	app.writeJSON(w, status, apiError{Error: http.StatusText(status)})
+}
+
+// Send E401 asking the client for credentials
+func (app *application) apiUnauthorized(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="snippetbox"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="snippetbox"`)
+	app.apiClientError(w, http.StatusUnauthorized)
+}
+
+// Send E400 for a body that could not be decoded
+func (app *application) apiBadRequest(w http.ResponseWriter, err error) {
+	app.writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+}
+
+// Send E422 listing the invalid fields
+func (app *application) apiValidationError(w http.ResponseWriter, fields map[string]string) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, apiError{
+		Error:  "Validation failed",
+		Fields: fields,
+	})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+// header carrying basic auth credentials for an API request
+func basicAuth(email, password string) http.Header {
+	credentials := base64.StdEncoding.EncodeToString([]byte(email + ":" + password))
+	return http.Header{"Authorization": {"Basic " + credentials}}
+}
+
+func TestAPISnippetList(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.do(t, http.MethodGet, "/api/v1/snippets", nil, nil)
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.StringContains(t, body, `"title":"An old silent pond"`)
+	assert.StringContains(t, body, `"page":{"last_page":1,"page":1,"page_size":10,"total":1}`)
+}
+
+func TestAPISnippetGet(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/api/v1/snippets/1",
+			wantCode: http.StatusOK,
+			wantBody: `"content":"An old silent pond..."`,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/api/v1/snippets/2",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"Not Found"}`,
+		},
+		{
+			name:     "Unlisted",
+			urlPath:  "/api/v1/snippets/Cs6gM3xVn1Bh",
+			wantCode: http.StatusOK,
+			wantBody: `"visibility":"unlisted"`,
+		},
+		{
+			name:     "Slug",
+			urlPath:  "/api/v1/snippets/Xq3vR8tLm2Pk",
+			wantCode: http.StatusOK,
+			wantBody: `"slug":"Xq3vR8tLm2Pk"`,
+		},
+		{
+			name:     "Protected",
+			urlPath:  "/api/v1/snippets/Lm8pQ2rT5vWy",
+			wantCode: http.StatusForbidden,
+			wantBody: `{"error":"This snippet is password protected"}`,
+		},
+		{
+			name:     "View limited",
+			urlPath:  "/api/v1/snippets/Bn2cV5xZq8Tr",
+			wantCode: http.StatusOK,
+			wantBody: `"views_left":0`,
+		},
+		{
+			name:     "Unlisted by ID",
+			urlPath:  "/api/v1/snippets/5",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"Not Found"}`,
+		},
+		{
+			name:     "Private",
+			urlPath:  "/api/v1/snippets/Pr5dK2wQz8Lf",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"Not Found"}`,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/api/v1/snippets/foo",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"Not Found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.do(t, http.MethodGet, tt.urlPath, nil, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+			// sequential IDs are never given away
+			assert.Equal(t, strings.Contains(body, `"id"`), false)
+		})
+	}
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const validBody = `{"title": "Build log", "content": "ok", "tags": ["ci"], "expires": 7}`
+
+	tests := []struct {
+		name     string
+		body     string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid submission",
+			body:     validBody,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusCreated,
+			wantBody: `"url":"/snippet/view/Nk4hF7sJd2Qa"`,
+		},
+		{
+			name:     "No credentials",
+			body:     validBody,
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"error":"Unauthorized"}`,
+		},
+		{
+			name:     "Wrong password",
+			body:     validBody,
+			header:   basicAuth("alice@example.com", "wrong"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Password of a two-factor account",
+			body:     validBody,
+			header:   basicAuth("carol@example.com", "pa$$word"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Invalid fields",
+			body:     `{"title": "", "content": "ok", "expires": 0}`,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"fields":{"expires":"This field must be between 1 minute and 100 years","title":"This field cannot be blank"}`,
+		},
+		{
+			name:     "Never expires",
+			body:     `{"title": "Build log", "content": "ok", "expiry": "never"}`,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Expires in the past",
+			body:     `{"title": "Build log", "content": "ok", "expires_at": "2020-01-01T00:00:00Z"}`,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"expires_at":"This field must be in the future, and less than 100 years away"`,
+		},
+		{
+			name:     "Unknown field",
+			body:     `{"title": "Build log", "colour": "red"}`,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Malformed JSON",
+			body:     `{"title": `,
+			header:   basicAuth("alice@example.com", "pa$$word"),
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.do(t, http.MethodPost, "/api/v1/snippets", strings.NewReader(tt.body), tt.header)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusCreated {
+				assert.Equal(t, header.Get("Location"), "/api/v1/snippets/Nk4hF7sJd2Qa")
+				assert.Equal(t, strings.Contains(body, `"id"`), false)
+			}
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPISnippetUpdateDelete(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	auth := basicAuth("alice@example.com", "pa$$word")
+
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "Update own snippet",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/snippets/Xq3vR8tLm2Pk",
+			body:     `{"title": "New title", "content": "New content"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Update own snippet by ID",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/snippets/1",
+			body:     `{"title": "New title", "content": "New content"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Update somebody else's snippet",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/snippets/Wn7bT4yHc9Js",
+			body:     `{"title": "New title", "content": "New content"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Update somebody else's snippet by ID",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/snippets/3",
+			body:     `{"title": "New title", "content": "New content"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Update with blank content",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/snippets/1",
+			body:     `{"title": "New title", "content": ""}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Delete own snippet",
+			method:   http.MethodDelete,
+			urlPath:  "/api/v1/snippets/Xq3vR8tLm2Pk",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Delete somebody else's snippet",
+			method:   http.MethodDelete,
+			urlPath:  "/api/v1/snippets/Wn7bT4yHc9Js",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Delete non-existent snippet",
+			method:   http.MethodDelete,
+			urlPath:  "/api/v1/snippets/Nk4hF7sJd2Qb",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.do(t, tt.method, tt.urlPath, strings.NewReader(tt.body), auth)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const validBody = `{"title": "Build log", "content": "ok", "expires": 7}`
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Read-write token",
+			token:    "sb_WRITETOKEN",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Read-only token",
+			token:    "sb_READTOKEN",
+			wantCode: http.StatusForbidden,
+			wantBody: `{"error":"This token is read-only"}`,
+		},
+		{
+			name:     "Unknown token",
+			token:    "sb_REVOKED",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Authorization": {"Bearer " + tt.token}}
+
+			code, _, body := ts.do(t, http.MethodPost, "/api/v1/snippets", strings.NewReader(validBody), header)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Read-only token can read", func(t *testing.T) {
+		header := http.Header{"Authorization": {"Bearer sb_READTOKEN"}}
+
+		code, _, _ := ts.do(t, http.MethodGet, "/api/v1/snippets/1", nil, header)
+
+		assert.Equal(t, code, http.StatusOK)
+	})
+}
@@ -3,3 +3,11 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// holds the ID of the user making an API request, see authenticateAPI()
+// and authenticateToken()
+const authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+
+// holds the scope the API request was granted, one of models.ScopeRead or
+// models.ScopeReadWrite
+const scopeContextKey = contextKey("scope")
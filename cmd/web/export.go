@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"snippetbox.opre.net/internal/models"
+)
+
+// What to do with the snippets of a deleted account
+const (
+	deletedSnippetsDelete    = "delete"
+	deletedSnippetsAnonymize = "anonymize"
+)
+
+// Everything we keep about a user, as handed out by /account/export
+type accountExport struct {
+	Exported time.Time       `json:"exported"`
+	User     exportUser      `json:"user"`
+	Tokens   []exportToken   `json:"tokens"`
+	Snippets []apiSnippet    `json:"snippets"`
+	Sessions []exportSession `json:"sessions"`
+}
+
+type exportUser struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Verified bool      `json:"verified"`
+	Created  time.Time `json:"created"`
+}
+
+type exportToken struct {
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used"`
+}
+
+type exportSession struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// how many snippets to fetch at a time while exporting
+const exportPageSize = 100
+
+// Gather the user's data for an export
+func (app *application) newAccountExport(userID int) (*accountExport, error) {
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &accountExport{
+		Exported: time.Now().UTC(),
+		User: exportUser{
+			ID:       user.ID,
+			Name:     user.Name,
+			Email:    user.Email,
+			Verified: user.Verified,
+			Created:  user.Created,
+		},
+		Tokens:   []exportToken{},
+		Snippets: []apiSnippet{},
+		Sessions: []exportSession{},
+	}
+
+	tokens, err := app.tokens.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		t := exportToken{Name: token.Name, Scope: token.Scope, Created: token.Created}
+		if !token.LastUsed.IsZero() {
+			t.LastUsed = &token.LastUsed
+		}
+		export.Tokens = append(export.Tokens, t)
+	}
+
+	// expired snippets are still stored, so they are included too
+	for offset := 0; ; offset += exportPageSize {
+		snippets, err := app.snippets.ByUser(userID, exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, snippet := range snippets {
+			export.Snippets = append(export.Snippets, newAPISnippet(snippet))
+		}
+		if len(snippets) < exportPageSize {
+			break
+		}
+	}
+
+	sessions, err := app.sessions.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, exportSession{
+			IP:        s.IP,
+			UserAgent: s.UserAgent,
+			Created:   s.Created,
+			LastSeen:  s.LastSeen,
+		})
+	}
+
+	return export, nil
+}
+
+// Write the export as a ZIP archive holding account.json and every snippet
+// as a file of its own under snippets/
+func writeExportZip(w io.Writer, export *accountExport) error {
+	archive := zip.NewWriter(w)
+
+	f, err := archive.Create("account.json")
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(export)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range export.Snippets {
+		// prefix the slug, titles don't have to be unique
+		name := fmt.Sprintf("snippets/%s-%s", s.Slug, snippetFilename(&models.Snippet{
+			Slug:     s.Slug,
+			Title:    s.Title,
+			Language: s.Language,
+		}))
+
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: s.Created,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(f, s.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image/png"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/otp/totp"
+	"snippetbox.opre.net/internal/diff"
 	"snippetbox.opre.net/internal/models"
+	"snippetbox.opre.net/internal/syntax"
 	"snippetbox.opre.net/internal/validator"
 )
 
@@ -15,7 +24,139 @@ import (
 type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
+	Expiry              string `form:"expiry"`
 	Expires             int    `form:"expires"`
+	ExpiresUnit         string `form:"expires_unit"`
+	ExpiresAt           string `form:"expires_at"`
+	Tags                string `form:"tags"`
+	Language            string `form:"language"`
+	Visibility          string `form:"visibility"`
+	Password            string `form:"password"`
+	Views               int    `form:"views"`
+	validator.Validator `form:"-"`
+}
+
+// validate checks the fields shared by the create and edit snippet forms
+func (form *snippetCreateForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(syntax.Supported(form.Language), "language", "This field must be one of the listed languages")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate),
+		"visibility", "This field must be public, unlisted or private")
+
+	tags := parseTags(form.Tags)
+	form.CheckField(len(tags) <= 10, "tags", "A snippet cannot have more than 10 tags")
+	for _, tag := range tags {
+		form.CheckField(validator.MaxChars(tag, 30), "tags", "Tags cannot be more than 30 characters long")
+		form.CheckField(validator.Matches(tag, validator.TagRX), "tags", "Tags may only contain letters, digits and + . _ -")
+	}
+}
+
+// Ways of saying when a snippet expires: in some amount of time, at an exact
+// time or never
+const (
+	expiryIn    = "in"
+	expiryAt    = "at"
+	expiryNever = "never"
+)
+
+// units the amount of time until a snippet expires can be given in
+var expiryUnits = map[string]time.Duration{
+	"minutes": time.Minute,
+	"hours":   time.Hour,
+	"days":    24 * time.Hour,
+}
+
+// snippets can't be set to expire further ahead than this, which also keeps
+// the amount from overflowing a time.Duration
+const maxExpiry = 100 * 365 * 24 * time.Hour
+
+// parse an exact expiry time. Browsers send datetime-local values, which are
+// taken as UTC like every date shown on the site, API clients can also send
+// RFC 3339 timestamps.
+func parseExpiresAt(value string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.UTC)
+	if err != nil {
+		return time.Parse(time.RFC3339, value)
+	}
+	return t, nil
+}
+
+// validateExpires checks the expiry and view limit, which are only chosen when
+// creating a snippet or extending its expiry, and works out when the snippet
+// expires, counting from now. The zero time means it never does. If
+// maxLifetime is set, snippets may be kept no longer than that after they were
+// created. New snippets pass the same time as now and created, so asking for
+// exactly the maximum lifetime is allowed.
+func (form *snippetCreateForm) validateExpires(now, created time.Time, maxLifetime time.Duration) time.Time {
+	// a bare amount, like older API clients send, means days
+	if form.Expiry == "" {
+		form.Expiry = expiryIn
+		if form.ExpiresAt != "" {
+			form.Expiry = expiryAt
+		}
+	}
+	if form.ExpiresUnit == "" {
+		form.ExpiresUnit = "days"
+	}
+
+	form.CheckField(form.Views >= 0 && form.Views <= 1000, "views", "This field must be between 0 and 1000")
+
+	var expires time.Time
+	field := "expiry"
+
+	switch form.Expiry {
+	case expiryIn:
+		field = "expires"
+		unit, ok := expiryUnits[form.ExpiresUnit]
+		if !ok {
+			form.AddFieldError(field, "This field must be in minutes, hours or days")
+			return time.Time{}
+		}
+		if form.Expires < 1 || time.Duration(form.Expires) > maxExpiry/unit {
+			form.AddFieldError(field, "This field must be between 1 minute and 100 years")
+			return time.Time{}
+		}
+		expires = now.Add(time.Duration(form.Expires) * unit)
+	case expiryAt:
+		field = "expires_at"
+		t, err := parseExpiresAt(form.ExpiresAt)
+		if err != nil {
+			form.AddFieldError(field, "This field must be a date and time")
+			return time.Time{}
+		}
+		if !t.After(now) || t.After(now.Add(maxExpiry)) {
+			form.AddFieldError(field, "This field must be in the future, and less than 100 years away")
+			return time.Time{}
+		}
+		expires = t
+	case expiryNever:
+	default:
+		form.AddFieldError(field, "This field must be in, at or never")
+		return time.Time{}
+	}
+
+	if maxLifetime > 0 {
+		limit := created.Add(maxLifetime)
+		if expires.IsZero() || expires.After(limit) {
+			form.AddFieldError(field, fmt.Sprintf("Snippets cannot be kept past %s", humanDate(limit)))
+		}
+	}
+
+	return expires
+}
+
+// validatePassword checks the optional access password, which can also only
+// be set when creating a snippet
+func (form *snippetCreateForm) validatePassword() {
+	if form.Password != "" {
+		form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	}
+}
+
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
@@ -39,6 +180,45 @@ type accountPasswordUpdateForm struct {
 	validator.Validator `form:"-"`
 }
 
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	NewPassword         string `form:"new password"`
+	ConfirmPassword     string `form:"confirm password"`
+	validator.Validator `form:"-"`
+}
+
+type apiTokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	validator.Validator `form:"-"`
+}
+
+type twoFactorCodeForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+type twoFactorDisableForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+type accountProfileForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	// get most recent snippets
@@ -64,6 +244,90 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	app.render(w, http.StatusOK, "home.tmpl.html", data)
 }
 
+// Browse every unexpired snippet, a page at a time
+func (app *application) snippetList(w http.ResponseWriter, r *http.Request) {
+	page := newPagination(r, snippetsPageSize)
+
+	total, err := app.snippets.Count()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.Total = total
+
+	snippets, err := app.snippets.List(page.PageSize, page.Offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Pagination = page
+
+	app.render(w, http.StatusOK, "list.tmpl.html", data)
+}
+
+// Search snippet titles and content, most relevant matches first
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Query = strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// nothing to look for yet, just show the search form
+	if data.Query == "" {
+		app.render(w, http.StatusOK, "search.tmpl.html", data)
+		return
+	}
+
+	page := newPagination(r, snippetsPageSize)
+
+	total, err := app.snippets.CountSearch(data.Query)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.Total = total
+
+	snippets, err := app.snippets.Search(data.Query, page.PageSize, page.Offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Snippets = snippets
+	data.Pagination = page
+
+	app.render(w, http.StatusOK, "search.tmpl.html", data)
+}
+
+// List the unexpired snippets carrying a tag, a page at a time
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	parameters := httprouter.ParamsFromContext(r.Context())
+	tag := parameters.ByName("name")
+
+	page := newPagination(r, snippetsPageSize)
+
+	total, err := app.snippets.CountByTag(tag)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.Total = total
+
+	snippets, err := app.snippets.ByTag(tag, page.PageSize, page.Offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Snippets = snippets
+	data.Pagination = page
+
+	app.render(w, http.StatusOK, "tag.tmpl.html", data)
+}
+
 func (app *application) about(w http.ResponseWriter, r *http.Request) {
 	// render template
 	app.render(w, http.StatusOK, "about.tmpl.html", app.newTemplateData(r))
@@ -71,19 +335,46 @@ func (app *application) about(w http.ResponseWriter, r *http.Request) {
 
 // snippetView handler function
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	// get parameters from request context
-	parameters := httprouter.ParamsFromContext(r.Context())
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	id, err := strconv.Atoi(parameters.ByName("id"))
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
 
-	// check for invalid id input
-	if err != nil || id < 1 {
-		app.notFoundError(w)
+	// protected snippets ask for their password first
+	if app.snippetLocked(r, snippet) {
+		data.Form = snippetUnlockForm{}
+		app.render(w, http.StatusOK, "unlock.tmpl.html", data)
+		return
+	}
+
+	// view limited snippets warn before anything is counted, so link previews
+	// and crawlers don't use up the views
+	if app.viewCounted(r, snippet) {
+		app.render(w, http.StatusOK, "reveal.tmpl.html", data)
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	app.render(w, http.StatusOK, "view.tmpl.html", data)
+}
+
+// Show a view limited snippet once the reader has confirmed they want to see
+// it, counting the view
+func (app *application) snippetRevealPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if app.snippetLocked(r, snippet) || !app.viewCounted(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
 
+	// somebody else may have used up the last view in the meantime
+	snippet, err := app.snippets.View(snippet.ID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFoundError(w)
@@ -95,216 +386,1363 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	if snippet.ViewsLeft == 0 {
+		data.Flash = "This snippet has now been deleted, nobody can view it again."
+	}
 	app.render(w, http.StatusOK, "view.tmpl.html", data)
 }
 
+// Check the password of a protected snippet and remember in the session that
+// it has been unlocked
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetUnlockForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if form.Valid() {
+		err = app.snippets.Unlock(snippet.ID, form.Password)
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("password", "Incorrect password")
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "unlock.tmpl.html", data)
+		return
+	}
+
+	app.unlockSnippet(r, snippet.ID)
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// Send the snippet content as plain text, so it can be piped into other
+// tools without any HTML getting in the way
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// locked and view limited snippets are only ever shown on their page
+	if app.snippetLocked(r, snippet) || app.viewCounted(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
+}
+
+// Send the snippet content as a file download named after its title and
+// language, e.g. "hello-world.go"
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// locked and view limited snippets are only ever shown on their page
+	if app.snippetLocked(r, snippet) || app.viewCounted(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": snippetFilename(snippet),
+	})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Write([]byte(snippet.Content))
+}
+
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	// open snippet creating form
-	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	form := snippetCreateForm{
+		Expiry:      expiryIn,
+		Expires:     365,
+		ExpiresUnit: "days",
+		Visibility:  models.VisibilityPublic,
 	}
+
+	// snippets may not be allowed to live for a year
+	if app.maxLifetime > 0 && app.maxLifetime < 365*24*time.Hour {
+		form.Expires, form.ExpiresUnit = int(app.maxLifetime/time.Minute), "minutes"
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
 	app.render(w, http.StatusOK, "create.tmpl.html", data)
 }
 
 // function to post created snippets
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 
-	// Insert snippet into DB
+	// Insert snippet into DB
+
+	// create data form
+	var createFrom snippetCreateForm
+
+	// use the decoder to pass the value from the request into the form
+	err := app.decodePostForm(r, &createFrom)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// check for form validity
+	createFrom.validate()
+	now := time.Now()
+	expires := createFrom.validateExpires(now, now, app.maxLifetime)
+	createFrom.validatePassword()
+
+	// Validation erros, re-render form
+	if !(createFrom.Valid()) {
+		data := app.newTemplateData(r)
+		data.Form = createFrom
+		app.render(w, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		return
+	}
+
+	// no language picked? try to work it out from the content
+	if createFrom.Language == "" {
+		createFrom.Language = syntax.Detect(createFrom.Content)
+	}
+
+	// all clear? insert snippet into DB, owned by the logged in user
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	id, slug, err := app.snippets.Insert(userID, createFrom.Title, createFrom.Content, createFrom.Language, createFrom.Visibility, createFrom.Password, expires, createFrom.Views)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.snippets.SetTags(id, parseTags(createFrom.Tags))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Use the Put() method to add a string value ("Snippet successfully
+	// created!") and the corresponding key ("flash") to the session data.
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+	// Redirect user to viewing newly-created snippet
+	// build URL
+	http.Redirect(w, r, "/snippet/view/"+slug, http.StatusSeeOther)
+}
+
+// Display the edit form for a snippet owned by the logged in user
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetCreateForm{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Tags:       strings.Join(snippet.Tags, ", "),
+		Language:   snippet.Language,
+		Visibility: snippet.Visibility,
+	}
+	app.render(w, http.StatusOK, "edit.tmpl.html", data)
+}
+
+// Validate the edited snippet and write the changes to the DB
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
+		return
+	}
+
+	if form.Language == "" {
+		form.Language = syntax.Detect(form.Content)
+	}
+
+	err = app.snippets.Update(snippet.ID, form.Title, form.Content, form.Language, form.Visibility)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.snippets.SetTags(snippet.ID, parseTags(form.Tags))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// Display the form for pushing back the expiry of a snippet owned by the
+// logged in user
+func (app *application) snippetExtend(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippetIncludingExpired(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetCreateForm{
+		Expiry:      expiryIn,
+		Expires:     7,
+		ExpiresUnit: "days",
+	}
+	app.render(w, http.StatusOK, "extend.tmpl.html", data)
+}
+
+// Validate and store the new expiry, which has to be later than the current one
+func (app *application) snippetExtendPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippetIncludingExpired(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	expires := form.validateExpires(time.Now(), snippet.Created, app.maxLifetime)
+
+	if snippet.Expires.IsZero() {
+		form.AddNonFieldError("This snippet never expires already")
+	} else if form.Valid() && !expires.IsZero() && !expires.After(snippet.Expires) {
+		form.AddNonFieldError("The new expiry must be later than " + humanDate(snippet.Expires))
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "extend.tmpl.html", data)
+		return
+	}
+
+	err = app.snippets.Extend(snippet.ID, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet expiry successfully extended!")
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// Show every revision of a snippet along with a diff between two of them,
+// picked with the from and to query parameters. Without them, or when they
+// don't name a revision, the latest change is shown
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// old revisions give the content away, so they are guarded like the
+	// snippet itself
+	if app.snippetLocked(r, snippet) || app.viewCounted(r, snippet) {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+
+	// a snippet that was never edited has nothing to compare
+	if len(revisions) > 1 {
+		from := findRevision(revisions, r.URL.Query().Get("from"), revisions[1])
+		to := findRevision(revisions, r.URL.Query().Get("to"), revisions[0])
+
+		data.Diff = &revisionDiff{
+			From:  from,
+			To:    to,
+			Hunks: diff.Unified(from.Content, to.Content, diffContext),
+		}
+	}
+
+	app.render(w, http.StatusOK, "history.tmpl.html", data)
+}
+
+// Make an older revision of a snippet owned by the logged in user the current
+// one again
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revision, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("revision"))
+	if err != nil || revision < 1 {
+		app.notFoundError(w)
+		return
+	}
+
+	err = app.snippets.Restore(snippet.ID, revision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Revision #%d successfully restored!", revision))
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Slug, http.StatusSeeOther)
+}
+
+// Remove a snippet owned by the logged in user
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.ownedSnippetID(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	// send out the sign up form template
+	data := app.newTemplateData(r)
+	data.Form = userSignupFrom{}
+	app.render(w, http.StatusOK, "signup.tmpl.html", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	// Validates the from posted to create a new user and adds them to the database
+
+	// initalize form
+	var form userSignupFrom
+
+	// Decode and place form data into form
+	err := app.decodePostForm(r, &form)
+
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// validate form data
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	if !form.Valid() {
+		// invalid user input, return to signup form and re-enter data, fill
+		// pre-existing fields except for the password
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		return
+	}
+
+	// Insert user into DB
+	id, err := app.users.Insert(form.Name, form.Email, form.Password)
+
+	if err != nil {
+		// check if the Error is caused by a dublicate Email,
+		//  if so, Re-render template with given data
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+
+		} else {
+			app.serverError(w, err)
+
+		}
+		return
+	}
+	err = app.sendVerificationEmail(id, form.Name, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// all good? add flash message to notify of success
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. We've emailed you a link to confirm your address, please log in.")
+	// and redirect to login page
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Confirm the email address a verification link was sent to
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	id, email, err := app.parseVerificationToken(token)
+	if err != nil {
+		app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.Verify(id, email)
+	if err != nil {
+		// the account is gone or its address has changed since
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, your email address is confirmed.")
+
+	if app.isAuthenticated(r) {
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Send the logged in user a fresh verification link
+func (app *application) userVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if user.Verified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already confirmed.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendVerificationEmail(user.ID, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent a new verification link to "+user.Email+".")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, http.StatusOK, "login.tmpl.html", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	// initalize form
+	var form userLoginForm
+
+	// Decode and place form data into form
+	err := app.decodePostForm(r, &form)
+
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// validate form data
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		return
+	}
+
+	// Refuse to even check the password while the account or IP address is
+	// locked out after too many failures
+	wait, err := app.loginWait(r, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if wait > 0 {
+		form.AddNonFieldError(tooManyAttempts(wait))
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "login.tmpl.html", data)
+		return
+	}
+
+	// Check whether the credentials are valid. If they're not, add a generic
+	// non-field error message and re-display the login page.
+	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.loginFailed(r, form.Email)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			form.AddNonFieldError("Email or password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// users with two-factor authentication have to enter a code before
+	// they are logged in
+	_, err = app.twoFactor.Get(id)
+	if err == nil {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "twoFactorUserID", id)
+		app.sessionManager.Put(r.Context(), "twoFactorStarted", time.Now().Unix())
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	// the login succeeded, so the account's failures no longer count. The IP
+	// address keeps its count, or logging into one account would clear the
+	// way to guess at others.
+	err = app.loginAccounts.Reset(accountKey(form.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.logIn(w, r, id)
+}
+
+// Display the second login step, asking for a TOTP or recovery code
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.twoFactorUserID(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.render(w, http.StatusOK, "logincode.tmpl.html", data)
+}
+
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := app.twoFactorUserID(r)
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "logincode.tmpl.html", data)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tf, err := app.twoFactor.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// try the code as a TOTP code first and as a recovery code second. A
+	// TOTP code only works once, as RFC 6238 asks, so a code seen over
+	// somebody's shoulder can't be replayed while it is still valid
+	ok := false
+	if step, valid := totpStep(form.Code, tf.Secret, time.Now()); valid {
+		err = app.twoFactor.UseStep(id, step)
+		if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+			app.serverError(w, err)
+			return
+		}
+		ok = err == nil
+	}
+	if !ok {
+		err = app.twoFactor.UseRecoveryCode(id, form.Code)
+		if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+			app.serverError(w, err)
+			return
+		}
+		ok = err == nil
+	}
+
+	if !ok {
+		// wrong codes count towards locking the account out just like
+		// wrong passwords, so the password can't be used to keep guessing
+		err = app.loginFailed(r, user.Email)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		// only allow a handful of guesses before starting over
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= twoFactorMaxAttempts {
+			app.clearTwoFactor(r)
+			app.sessionManager.Put(r.Context(), "flash", "Too many incorrect codes, please log in again.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		form.AddNonFieldError("That code is incorrect")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "logincode.tmpl.html", data)
+		return
+	}
+
+	err = app.loginAccounts.Reset(accountKey(user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.clearTwoFactor(r)
+	app.logIn(w, r, id)
+}
+
+// Display the form asking for the email address of a forgotten account
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.render(w, http.StatusOK, "forgot.tmpl.html", data)
+}
+
+// Email a password reset link to the address given, if it belongs to a user
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "forgot.tmpl.html", data)
+		return
+	}
+
+	user, err := app.users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	// Respond the same way, and just as quickly, whether or not the address
+	// is known, so the form can't be used to find out who has an account.
+	// The link is created and mailed after the response has gone out.
+	if err == nil {
+		app.runBackground(func() error {
+			token, err := app.resets.Insert(user.ID, passwordResetTTL)
+			if err != nil {
+				return err
+			}
+
+			body := fmt.Sprintf("Hi %s,\n\n"+
+				"Someone asked to reset the password of your Snippetbox account. If it was you, "+
+				"follow this link within the next hour to choose a new password:\n\n"+
+				"%s/user/password/reset/%s\n\n"+
+				"If it wasn't you, you can safely ignore this email.\n",
+				user.Name, app.baseURL, token)
+
+			return app.mailer.Send(user.Email, "Reset your Snippetbox password", body)
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If an account uses that address, we've emailed it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Display the form for choosing a new password, if the reset link is valid
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	exists, err := app.resets.Exists(token)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !exists {
+		app.invalidResetLink(w, r)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{}
+	data.ResetToken = token
+	app.render(w, http.StatusOK, "reset.tmpl.html", data)
+}
+
+// Use up the reset token and replace the user's password
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	var form passwordResetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "This field must be at least 8 characters long")
+	form.CheckField(form.NewPassword == form.ConfirmPassword, "confirmPassword", "Confirmation must match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.ResetToken = token
+		app.render(w, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+		return
+	}
+
+	id, err := app.resets.Consume(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.users.PasswordSet(id, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// nobody who knew the old password stays logged in
+	tokens, err := app.sessions.DeleteOthers(id, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.revokeSessions(tokens)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// proving control of the email address unlocks the account
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.loginAccounts.Reset(accountKey(user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := app.sessions.DeleteToken(app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Use the RenewToken() method on the current session to change the session
+	// ID again.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Remove the authenticatedUserID from the session data so that the user is
+	// 'logged out'.
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	// Add a flash message to the session to confirm to the user that they've been
+	// logged out.
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+
+	// Redirect the user to the application home page.
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Show whether two-factor authentication is on. If it isn't, start enrolling
+// with a new secret that is kept in the session until it is confirmed.
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	data := app.newTemplateData(r)
+
+	_, err := app.twoFactor.Get(id)
+	if err == nil {
+		data.TwoFactorEnabled = true
+		data.Form = twoFactorDisableForm{}
+		app.render(w, http.StatusOK, "twofactor.tmpl.html", data)
+		return
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "Snippetbox",
+		AccountName: user.Email,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "twoFactorKey", key.URL())
+
+	data.TOTPSecret = key.Secret()
+	data.Form = twoFactorCodeForm{}
+	app.render(w, http.StatusOK, "twofactor.tmpl.html", data)
+}
+
+// Serve the QR code of the secret being enrolled as a PNG image
+func (app *application) accountTwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	key, err := app.pendingTwoFactorKey(r)
+	if err != nil {
+		app.notFoundError(w)
+		return
+	}
+
+	img, err := key.Image(200, 200)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	err = png.Encode(w, img)
+	if err != nil {
+		app.errLog.Print(err)
+	}
+}
+
+// Turn on two-factor authentication once the user proves their
+// authenticator app works by entering a first code
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	key, err := app.pendingTwoFactorKey(r)
+	if err != nil {
+		// the session expired or the page was never loaded
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	step, valid := totpStep(form.Code, key.Secret(), time.Now())
+	form.CheckField(valid, "code", "That code is incorrect, please try again")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.TOTPSecret = key.Secret()
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twofactor.tmpl.html", data)
+		return
+	}
+
+	codes, err := app.twoFactor.Enable(id, key.Secret(), step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "twoFactorKey")
+
+	// the recovery codes are only ever shown on this response
+	data := app.newTemplateData(r)
+	data.Flash = "Two-factor authentication is now on."
+	data.TwoFactorEnabled = true
+	data.RecoveryCodes = codes
+	data.Form = twoFactorDisableForm{}
+	app.render(w, http.StatusOK, "twofactor.tmpl.html", data)
+}
+
+// Turn off two-factor authentication, after checking the user's password
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form twoFactorDisableForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if form.Valid() {
+		user, err := app.users.Get(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		_, err = app.users.Authenticate(user.Email, form.Password)
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("password", "Password is incorrect")
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.TwoFactorEnabled = true
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "twofactor.tmpl.html", data)
+		return
+	}
+
+	err = app.twoFactor.Disable(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is now off.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// List the user's sessions, so they can log out the ones they don't
+// recognise
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.sessions.ForUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+
+	token := app.sessionManager.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == token {
+			data.CurrentSessionID = s.ID
+		}
+	}
+
+	app.render(w, http.StatusOK, "sessions.tmpl.html", data)
+}
 
-	// create data form
-	var createFrom snippetCreateForm
+// Log out one of the user's sessions
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	// use the decoder to pass the value from the request into the form
-	err := app.decodePostForm(r, &createFrom)
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id < 1 {
+		app.notFoundError(w)
+		return
+	}
+
+	token, err := app.sessions.Delete(id, userID)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
 	}
 
-	// check for form validity
-	createFrom.CheckField(validator.NotBlank(createFrom.Title), "title", "This field cannot be blank")
-	createFrom.CheckField(validator.MaxChars(createFrom.Title, 100), "title", "This field cannot be more than 100 characters long")
-	createFrom.CheckField(validator.NotBlank(createFrom.Content), "content", "This field cannot be blank")
-	createFrom.CheckField(validator.PermittedValue(createFrom.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	// The current session's data would be saved again at the end of the
+	// request, so it is logged out like userLogoutPost does instead
+	if token == app.sessionManager.Token(r.Context()) {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
 
-	// Validation erros, re-render form
-	if !(createFrom.Valid()) {
-		data := app.newTemplateData(r)
-		data.Form = createFrom
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+		app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// all clear? insert snippet into DB
-	id, err := app.snippets.Insert(createFrom.Title, createFrom.Content, createFrom.Expires)
+	err = app.revokeSessions([]string{token})
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	app.sessionManager.Put(r.Context(), "flash", "The session has been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// Log out every session of the user except the current one
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tokens, err := app.sessions.DeleteOthers(id, app.sessionManager.Token(r.Context()))
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Use the Put() method to add a string value ("Snippet successfully
-	// created!") and the corresponding key ("flash") to the session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	err = app.revokeSessions(tokens)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	// Redirect user to viewing newly-created snippet
-	// build URL
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	app.sessionManager.Put(r.Context(), "flash", "All your other sessions have been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	// send out the sign up form template
+// Display the form for changing the user's name and email address
+func (app *application) accountProfile(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	data := app.newTemplateData(r)
-	data.Form = userSignupFrom{}
-	app.render(w, http.StatusOK, "signup.tmpl.html", data)
+	data.Form = accountProfileForm{
+		Name:  user.Name,
+		Email: user.Email,
+	}
+	app.render(w, http.StatusOK, "profile.tmpl.html", data)
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	// Validates the from posted to create a new user and adds them to the database
+// Change the user's name and email address. A new address needs the
+// password to be re-entered, and has to be confirmed again.
+func (app *application) accountProfilePost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	// initalize form
-	var form userSignupFrom
+	var form accountProfileForm
 
-	// Decode and place form data into form
 	err := app.decodePostForm(r, &form)
-
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// validate form data
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	form.Email = strings.TrimSpace(form.Email)
+	// addresses are compared case-insensitively by the database too, so a
+	// change in case alone keeps the address verified
+	emailChanged := !strings.EqualFold(form.Email, user.Email)
+
 	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	form.CheckField(validator.MaxChars(form.Email, 255), "email", "This field cannot be more than 255 characters long")
+
+	if emailChanged {
+		form.CheckField(validator.NotBlank(form.Password), "password", "Enter your password to change your email address")
+
+		if form.Valid() {
+			_, err = app.users.Authenticate(user.Email, form.Password)
+			if err != nil {
+				if !errors.Is(err, models.ErrInvalidCredentials) {
+					app.serverError(w, err)
+					return
+				}
+				form.AddFieldError("password", "Password is incorrect")
+			}
+		}
+	}
+
+	if form.Valid() {
+		err = app.users.Update(id, form.Name, form.Email)
+		if err != nil {
+			if !errors.Is(err, models.ErrDuplicateEmail) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("email", "Email address is already in use")
+		}
+	}
 
 	if !form.Valid() {
-		// invalid user input, return to signup form and re-enter data, fill
-		// pre-existing fields except for the password
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		app.render(w, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
 		return
 	}
 
-	// Insert user into DB
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	if !emailChanged {
+		app.sessionManager.Put(r.Context(), "flash", "Your name has been updated.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
 
-	if err != nil {
-		// check if the Error is caused by a dublicate Email,
-		//  if so, Re-render template with given data
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+	// The change is already saved, so a mail server that's down mustn't fail
+	// the request. Both emails go out after the response, failures are logged.
+	// The old address is told about the change, in case someone else made it.
+	app.runBackground(func() error {
+		body := fmt.Sprintf("Hi %s,\n\n"+
+			"The email address of your Snippetbox account was changed to %s. If you didn't "+
+			"make this change, please reset your password and get in touch with us.\n",
+			user.Name, form.Email)
 
-		} else {
-			app.serverError(w, err)
+		return app.mailer.Send(user.Email, "Your Snippetbox email address was changed", body)
+	})
 
-		}
+	app.runBackground(func() error {
+		return app.sendVerificationEmail(id, form.Name, form.Email)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your details have been updated. We've emailed a link to "+form.Email+" to confirm the new address.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// Download everything stored about the user, as JSON or as a ZIP archive
+// with the snippets as separate files
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	// all good? add flash message to notify of success
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
-	// and redirect to login page
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+
+	export, err := app.newAccountExport(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// build the whole file first, so an error can still become a 500
+	buf := new(bytes.Buffer)
+	if format == "zip" {
+		err = writeExportZip(buf, export)
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(export)
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": "snippetbox-export." + format,
+	}))
+	w.Write(buf.Bytes())
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+// Ask the user to confirm they want their account deleted
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl.html", data)
+	data.Form = accountDeleteForm{}
+	data.KeepSnippets = app.deletedSnippets == deletedSnippetsAnonymize
+	app.render(w, http.StatusOK, "delete.tmpl.html", data)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-	// initalize form
-	var form userLoginForm
+// Delete the user's account once they re-enter their password, and log out
+// all of their sessions
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	// Decode and place form data into form
-	err := app.decodePostForm(r, &form)
+	var form accountDeleteForm
 
+	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// validate form data
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
+	if form.Valid() {
+		user, err := app.users.Get(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		_, err = app.users.Authenticate(user.Email, form.Password)
+		if err != nil {
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("password", "Password is incorrect")
+		}
+	}
+
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		data.KeepSnippets = app.deletedSnippets == deletedSnippetsAnonymize
+		app.render(w, http.StatusUnprocessableEntity, "delete.tmpl.html", data)
 		return
 	}
 
-	// Check whether the credentials are valid. If they're not, add a generic
-	// non-field error message and re-display the login page.
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	// the session records go with the user, so collect their tokens first
+	tokens, err := app.sessions.DeleteOthers(id, "")
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
-		} else {
-			app.serverError(w, err)
-		}
+		app.serverError(w, err)
 		return
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.users.Delete(id, app.deletedSnippets == deletedSnippetsDelete)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Add the ID of the current user to the session, so that they are now
-	// 'logged in'.
-
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-
-	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
-
-	// Check what path the user tried to access before logging in,
-	//  Redirect them to that path
-
-	if path != "" {
-		http.Redirect(w, r, path, http.StatusSeeOther)
+	err = app.revokeSessions(tokens)
+	if err != nil {
+		app.serverError(w, err)
 		return
 	}
-	// Redirect the user to the create snippet page.
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
-}
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	// Use the RenewToken() method on the current session to change the session
-	// ID again.
-	err := app.sessionManager.RenewToken(r.Context())
+	// and carry on with a fresh, logged out session
+	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-
-	// Remove the authenticatedUserID from the session data so that the user is
-	// 'logged out'.
 	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
 
-	// Add a flash message to the session to confirm to the user that they've been
-	// logged out.
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
-
-	// Redirect the user to the application home page.
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted. Goodbye!")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -325,12 +1763,108 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 	}
 	app.infoLog.Print(user)
 	// Wrtie user data into template
+	_, err = app.twoFactor.Get(id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
 	data := app.newTemplateData(r)
 	data.User = user
+	data.TwoFactorEnabled = err == nil
 
 	app.render(w, http.StatusOK, "account.tmpl.html", data)
 }
 
+// List every snippet the logged in user has created, a page at a time
+func (app *application) accountSnippets(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	page := newPagination(r, snippetsPageSize)
+
+	total, err := app.snippets.CountByUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.Total = total
+
+	snippets, err := app.snippets.ByUser(id, page.PageSize, page.Offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Pagination = page
+
+	app.render(w, http.StatusOK, "snippets.tmpl.html", data)
+}
+
+// List the logged in user's API tokens along with a form to create another
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, http.StatusOK, apiTokenCreateForm{Scope: models.ScopeRead})
+}
+
+// Create a new API token. Its plaintext is only ever shown once, on the page
+// the user is redirected to
+func (app *application) accountTokensPost(w http.ResponseWriter, r *http.Request) {
+	var form apiTokenCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValue(form.Scope, models.ScopeRead, models.ScopeReadWrite), "scope", "This field must be read or read-write")
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	plaintext, err := app.tokens.Insert(id, form.Name, form.Scope)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "newToken", plaintext)
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+// Revoke one of the logged in user's API tokens
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	parameters := httprouter.ParamsFromContext(r.Context())
+
+	tokenID, err := strconv.Atoi(parameters.ByName("id"))
+	if err != nil || tokenID < 1 {
+		app.notFoundError(w)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	err = app.tokens.Delete(tokenID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
 // Display From for creating a new password
 func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
@@ -397,12 +1931,41 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 		return
 	}
 
+	// log out every other session, in case the old password was known to
+	// someone else
+	token := app.sessionManager.Token(r.Context())
+
+	tokens, err := app.sessions.DeleteOthers(id, token)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.revokeSessions(tokens)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	// the current session carries on under its new token
+	err = app.sessions.DeleteToken(token)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.trackSession(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	// all good? add flash message to notify of success
 	app.sessionManager.Put(r.Context(), "flash", "Password Changed Succesfully")
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pquerna/otp/totp"
 	"snippetbox.opre.net/internal/assert"
+	"snippetbox.opre.net/internal/mailer"
+	"snippetbox.opre.net/internal/models/mocks"
 )
 
 func TestPing(t *testing.T) {
@@ -39,10 +50,33 @@ func TestSnippetView(t *testing.T) {
 	}{
 		{
 			name:     "Valid ID",
-			urlPath:  "/snippet/view/1",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk",
 			wantCode: http.StatusOK,
 			wantBody: "An old silent pond...",
 		},
+		{
+			name:     "Shows author",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk",
+			wantCode: http.StatusOK,
+			wantBody: "By Alice",
+		},
+		{
+			name:     "Numbers lines",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk",
+			wantCode: http.StatusOK,
+			wantBody: `<span class="lnt">1`,
+		},
+		{
+			name:     "Non-existent slug",
+			urlPath:  "/snippet/view/Zz9zZz9zZz9z",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Numeric ID",
+			urlPath:  "/snippet/view/1",
+			wantCode: http.StatusMovedPermanently,
+			wantBody: "/snippet/view/Xq3vR8tLm2Pk",
+		},
 		{
 			name:     "Non-existent ID",
 			urlPath:  "/snippet/view/2",
@@ -83,6 +117,209 @@ func TestSnippetView(t *testing.T) {
 	}
 }
 
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unlisted by link", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/Cs6gM3xVn1Bh")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "A cicada shell...")
+	})
+
+	t.Run("Never expires", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/Cs6gM3xVn1Bh")
+
+		assert.StringContains(t, body, "Expires: Never")
+	})
+
+	t.Run("Unlisted by ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/view/5")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Private anonymous", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/view/Pr5dK2wQz8Lf")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Private raw", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/raw/Pr5dK2wQz8Lf")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Private other user", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t)
+
+		code, _, _ := ts.get(t, "/snippet/view/Pr5dK2wQz8Lf")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Private owner", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, _, body := ts.get(t, "/snippet/view/Pr5dK2wQz8Lf")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Winter seclusion...")
+	})
+
+	t.Run("Private owner by ID", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, header, _ := ts.get(t, "/snippet/view/4")
+
+		assert.Equal(t, code, http.StatusMovedPermanently)
+		assert.Equal(t, header.Get("Location"), "/snippet/view/Pr5dK2wQz8Lf")
+	})
+}
+
+func TestSnippetUnlock(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	unlock := func(t *testing.T, password string) (int, http.Header, string) {
+		_, _, body := ts.get(t, "/snippet/view/Lm8pQ2rT5vWy")
+
+		form := url.Values{}
+		form.Add("password", password)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		return ts.postForm(t, "/snippet/unlock/Lm8pQ2rT5vWy", form)
+	}
+
+	t.Run("Asks for the password", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/Lm8pQ2rT5vWy")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "is password protected")
+		assert.Equal(t, strings.Contains(body, "Lightning flash..."), false)
+	})
+
+	t.Run("Raw redirects", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/raw/Lm8pQ2rT5vWy")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/snippet/view/Lm8pQ2rT5vWy")
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		code, _, body := unlock(t, "wrong password")
+
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Incorrect password")
+	})
+
+	t.Run("Right password", func(t *testing.T) {
+		code, header, _ := unlock(t, mocks.SnippetPassword)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/snippet/view/Lm8pQ2rT5vWy")
+
+		code, _, body := ts.get(t, "/snippet/view/Lm8pQ2rT5vWy")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Lightning flash...")
+
+		code, _, body = ts.get(t, "/snippet/raw/Lm8pQ2rT5vWy")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, body, "Lightning flash...")
+	})
+
+	t.Run("Numeric ID", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/snippet/view/Lm8pQ2rT5vWy")
+
+		form := url.Values{}
+		form.Add("password", mocks.SnippetPassword)
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, header, _ := ts.postForm(t, "/snippet/unlock/6", form)
+
+		// a 301 would turn the form into a GET
+		assert.Equal(t, code, http.StatusPermanentRedirect)
+		assert.Equal(t, header.Get("Location"), "/snippet/unlock/Lm8pQ2rT5vWy")
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, _, body := ts.get(t, "/snippet/view/Lm8pQ2rT5vWy")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Lightning flash...")
+	})
+}
+
+func TestSnippetReveal(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Warns first", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/Bn2cV5xZq8Tr")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "will be deleted as soon as you view it")
+		assert.Equal(t, strings.Contains(body, "The first cold shower..."), false)
+	})
+
+	t.Run("Raw redirects", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/raw/Bn2cV5xZq8Tr")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/snippet/view/Bn2cV5xZq8Tr")
+	})
+
+	t.Run("Reveal", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/Bn2cV5xZq8Tr")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, _, body := ts.postForm(t, "/snippet/reveal/Bn2cV5xZq8Tr", form)
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "The first cold shower...")
+		assert.StringContains(t, body, "This snippet has now been deleted")
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, _, body := ts.get(t, "/snippet/view/Bn2cV5xZq8Tr")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "The first cold shower...")
+		assert.StringContains(t, body, "Views left: 1")
+	})
+}
+
 func TestUserSignup(t *testing.T) {
 	app := newTestApplication(t)
 	ts := newTestServer(t, app.routes())
@@ -232,3 +469,1774 @@ func TestSnippetCreate(t *testing.T) {
 		assert.StringContains(t, body, "<form action='/snippet/create' method='POST'>")
 	})
 }
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		status, header, _ := ts.get(t, "/snippet/edit/Xq3vR8tLm2Pk")
+
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	validCSRFToken := ts.login(t)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		title    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Owner",
+			urlPath:  "/snippet/edit/Xq3vR8tLm2Pk",
+			title:    "A new title",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Blank title",
+			urlPath:  "/snippet/edit/Xq3vR8tLm2Pk",
+			title:    "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/snippet/edit/Wn7bT4yHc9Js",
+			title:    "A new title",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent slug",
+			urlPath:  "/snippet/edit/Nk4hF7sJd2Qb",
+			title:    "A new title",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Own numeric ID",
+			urlPath:  "/snippet/edit/1",
+			title:    "A new title",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Somebody else's numeric ID",
+			urlPath:  "/snippet/edit/3",
+			title:    "A new title",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Some content")
+			form.Add("visibility", "public")
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Form is prefilled", func(t *testing.T) {
+		status, _, body := ts.get(t, "/snippet/edit/Xq3vR8tLm2Pk")
+
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, "An old silent pond...")
+	})
+}
+
+func TestSnippetDelete(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := ts.login(t)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Owner",
+			urlPath:  "/snippet/delete/Xq3vR8tLm2Pk",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/snippet/delete/Wn7bT4yHc9Js",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent slug",
+			urlPath:  "/snippet/delete/Nk4hF7sJd2Qb",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Somebody else's numeric ID",
+			urlPath:  "/snippet/delete/3",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAccountSnippets(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		status, header, _ := ts.get(t, "/account/snippets")
+
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	ts.login(t)
+
+	t.Run("Lists own snippets", func(t *testing.T) {
+		status, _, body := ts.get(t, "/account/snippets")
+
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, "An old silent pond")
+		assert.StringContains(t, body, "/snippet/edit/Xq3vR8tLm2Pk")
+		assert.StringContains(t, body, "Page 1 of 1")
+	})
+
+	t.Run("Page past the end", func(t *testing.T) {
+		status, _, body := ts.get(t, "/account/snippets?page=2")
+
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, "You haven't created any snippets yet")
+	})
+}
+
+func TestSnippetList(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{
+			name:     "First page",
+			urlPath:  "/snippets",
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Page metadata",
+			urlPath:  "/snippets?page=1",
+			wantBody: "Page 1 of 1",
+		},
+		{
+			name:     "Page past the end",
+			urlPath:  "/snippets?page=5",
+			wantBody: "There's nothing to see here... yet!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{
+			name:     "No query",
+			urlPath:  "/search",
+			wantBody: "<form class='search' action='/search' method='GET'>",
+		},
+		{
+			name:     "Highlights matches",
+			urlPath:  "/search?q=pond",
+			wantBody: "An old silent <mark>pond</mark>",
+		},
+		{
+			name:     "No matches",
+			urlPath:  "/search?q=frog",
+			wantBody: "No snippets matched",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestSnippetExtend(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := ts.login(t)
+
+	t.Run("Form", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/extend/Xq3vR8tLm2Pk")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "currently expires on")
+	})
+
+	t.Run("Form for an expired snippet", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/extend/Ex4pR7dWq2Ns")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "will soon be deleted")
+	})
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		expiry   string
+		expires  string
+		unit     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Later",
+			urlPath:  "/snippet/extend/Xq3vR8tLm2Pk",
+			expiry:   "in",
+			expires:  "7",
+			unit:     "days",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Never",
+			urlPath:  "/snippet/extend/Xq3vR8tLm2Pk",
+			expiry:   "never",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Sooner",
+			urlPath:  "/snippet/extend/Xq3vR8tLm2Pk",
+			expiry:   "in",
+			expires:  "5",
+			unit:     "minutes",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The new expiry must be later than",
+		},
+		{
+			name:     "Expired",
+			urlPath:  "/snippet/extend/Ex4pR7dWq2Ns",
+			expiry:   "in",
+			expires:  "1",
+			unit:     "days",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/snippet/extend/Wn7bT4yHc9Js",
+			expiry:   "never",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("expiry", tt.expiry)
+			form.Add("expires", tt.expires)
+			form.Add("expires_unit", tt.unit)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:     "Latest change",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk/history",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"Changes from #1 to #2",
+				"@@ -1,3 &#43;1,3 @@",
+				"<span class='removed'>-splash! Silence.</span>",
+				"<span class='added'>&#43;splash! Silence again.</span>",
+				"Title changed from",
+			},
+		},
+		{
+			name:     "Picked revisions",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk/history?from=2&to=1",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"Changes from #2 to #1",
+				"<span class='removed'>-splash! Silence again.</span>",
+			},
+		},
+		{
+			name:     "Same revision",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk/history?from=2&to=2",
+			wantCode: http.StatusOK,
+			wantBody: []string{"The content is the same in both revisions."},
+		},
+		{
+			name:     "Unknown revision",
+			urlPath:  "/snippet/view/Xq3vR8tLm2Pk/history?from=9",
+			wantCode: http.StatusOK,
+			wantBody: []string{"Changes from #1 to #2"},
+		},
+		{
+			name:     "Never edited",
+			urlPath:  "/snippet/view/Wn7bT4yHc9Js/history",
+			wantCode: http.StatusOK,
+			wantBody: []string{"hasn't been edited yet"},
+		},
+		{
+			name:         "Numeric ID",
+			urlPath:      "/snippet/view/1/history?from=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/snippet/view/Xq3vR8tLm2Pk/history?from=1",
+		},
+		{
+			name:         "Protected",
+			urlPath:      "/snippet/view/Lm8pQ2rT5vWy/history",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/Lm8pQ2rT5vWy",
+		},
+		{
+			name:         "View limited",
+			urlPath:      "/snippet/view/Bn2cV5xZq8Tr/history",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/Bn2cV5xZq8Tr",
+		},
+		{
+			name:     "Private",
+			urlPath:  "/snippet/view/Pr5dK2wQz8Lf/history",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+
+	t.Run("No restore for visitors", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/Xq3vR8tLm2Pk/history")
+
+		assert.Equal(t, strings.Contains(body, "/snippet/restore/"), false)
+	})
+}
+
+func TestSnippetRestore(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := ts.login(t)
+
+	t.Run("Restore button", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/Xq3vR8tLm2Pk/history")
+
+		assert.StringContains(t, body, "/snippet/restore/Xq3vR8tLm2Pk/1")
+	})
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Older revision",
+			urlPath:  "/snippet/restore/Xq3vR8tLm2Pk/1",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown revision",
+			urlPath:  "/snippet/restore/Xq3vR8tLm2Pk/9",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid revision",
+			urlPath:  "/snippet/restore/Xq3vR8tLm2Pk/first",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/snippet/restore/Wn7bT4yHc9Js/1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	t.Run("Flash", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/Xq3vR8tLm2Pk")
+
+		assert.StringContains(t, body, "Revision #1 successfully restored!")
+	})
+}
+
+func TestSnippetExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	app.maxLifetime = 30 * 24 * time.Hour
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := ts.login(t)
+
+	t.Run("Default within the maximum lifetime", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/create")
+
+		assert.StringContains(t, body, "value='43200'")
+	})
+
+	tests := []struct {
+		name      string
+		expiry    string
+		expires   string
+		unit      string
+		expiresAt string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:     "In minutes",
+			expiry:   "in",
+			expires:  "90",
+			unit:     "minutes",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:      "At a time",
+			expiry:    "at",
+			expiresAt: time.Now().UTC().Add(48 * time.Hour).Format("2006-01-02T15:04"),
+			wantCode:  http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown unit",
+			expiry:   "in",
+			expires:  "2",
+			unit:     "weeks",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be in minutes, hours or days",
+		},
+		{
+			name:      "In the past",
+			expiry:    "at",
+			expiresAt: "2020-01-01T00:00",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be in the future",
+		},
+		{
+			name:     "Default form",
+			expiry:   "in",
+			expires:  "43200",
+			unit:     "minutes",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Exactly the maximum lifetime",
+			expiry:   "in",
+			expires:  "30",
+			unit:     "days",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Past the maximum lifetime",
+			expiry:   "in",
+			expires:  "31",
+			unit:     "days",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Snippets cannot be kept past",
+		},
+		{
+			name:     "Never with a maximum lifetime",
+			expiry:   "never",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Snippets cannot be kept past",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "O snail")
+			form.Add("content", "Climb Mount Fuji, but slowly, slowly!")
+			form.Add("visibility", "public")
+			form.Add("expiry", tt.expiry)
+			form.Add("expires", tt.expires)
+			form.Add("expires_unit", tt.unit)
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePost(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := ts.login(t)
+
+	tests := []struct {
+		name       string
+		title      string
+		tags       string
+		visibility string
+		password   string
+		views      string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:       "Valid submission",
+			title:      "O snail",
+			tags:       "haiku, Poetry",
+			visibility: "public",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "No tags",
+			title:      "O snail",
+			visibility: "private",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Password",
+			title:      "O snail",
+			visibility: "public",
+			password:   "open sesame",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Short password",
+			title:      "O snail",
+			visibility: "public",
+			password:   "sesame",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be at least 8 characters long",
+		},
+		{
+			name:       "Burn after reading",
+			title:      "O snail",
+			visibility: "unlisted",
+			views:      "1",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Too many views",
+			title:      "O snail",
+			visibility: "public",
+			views:      "1001",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 0 and 1000",
+		},
+		{
+			name:       "Invalid visibility",
+			title:      "O snail",
+			visibility: "secret",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be public, unlisted or private",
+		},
+		{
+			name:     "Empty title",
+			title:    "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Invalid tag",
+			title:    "O snail",
+			tags:     "haiku, two words",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Tags may only contain letters, digits and &#43; . _ -",
+		},
+		{
+			name:     "Too many tags",
+			title:    "O snail",
+			tags:     "a,b,c,d,e,f,g,h,i,j,k",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "A snippet cannot have more than 10 tags",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Climb Mount Fuji, but slowly, slowly!")
+			form.Add("expires", "7")
+			form.Add("tags", tt.tags)
+			form.Add("visibility", tt.visibility)
+			form.Add("password", tt.password)
+			form.Add("views", tt.views)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/snippet/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, header.Get("Location"), "/snippet/view/Nk4hF7sJd2Qa")
+			}
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTagView(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{
+			name:     "Tagged snippets",
+			urlPath:  "/tag/haiku",
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Tags link to their page",
+			urlPath:  "/tag/haiku",
+			wantBody: "<a class='tag' href='/tag/haiku'>haiku</a>",
+		},
+		{
+			name:     "Unknown tag",
+			urlPath:  "/tag/limerick",
+			wantBody: "No snippets are tagged limerick.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Valid ID", func(t *testing.T) {
+		code, header, body := ts.get(t, "/snippet/raw/Xq3vR8tLm2Pk")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+		assert.Equal(t, header.Get("X-Content-Type-Options"), "nosniff")
+		assert.Equal(t, body, "An old silent pond...")
+	})
+
+	t.Run("Non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/raw/2")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestSnippetDownload(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Valid ID", func(t *testing.T) {
+		code, header, body := ts.get(t, "/snippet/download/Xq3vR8tLm2Pk")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Disposition"), "attachment; filename=an-old-silent-pond.txt")
+		assert.Equal(t, body, "An old silent pond...")
+	})
+
+	t.Run("Non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/download/2")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		status, header, _ := ts.get(t, "/account/tokens")
+
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	validCSRFToken := ts.login(t)
+
+	t.Run("Lists tokens", func(t *testing.T) {
+		status, _, body := ts.get(t, "/account/tokens")
+
+		assert.Equal(t, status, http.StatusOK)
+		assert.StringContains(t, body, "<td>CI</td>")
+		assert.StringContains(t, body, "/account/tokens/revoke/2")
+	})
+
+	t.Run("Invalid scope", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "CI")
+		form.Add("scope", "admin")
+		form.Add("csrf_token", validCSRFToken)
+
+		status, _, body := ts.postForm(t, "/account/tokens", form)
+
+		assert.Equal(t, status, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "This field must be read or read-write")
+	})
+
+	t.Run("Create shows the token once", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "CI")
+		form.Add("scope", "read-write")
+		form.Add("csrf_token", validCSRFToken)
+
+		status, header, _ := ts.postForm(t, "/account/tokens", form)
+
+		assert.Equal(t, status, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/tokens")
+
+		_, _, body := ts.get(t, "/account/tokens")
+		assert.StringContains(t, body, "<code>sb_NEWTOKEN</code>")
+
+		_, _, body = ts.get(t, "/account/tokens")
+		assert.Equal(t, strings.Contains(body, "sb_NEWTOKEN"), false)
+	})
+
+	t.Run("Revoke unknown token", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("csrf_token", validCSRFToken)
+
+		status, _, _ := ts.postForm(t, "/account/tokens/revoke/9", form)
+
+		assert.Equal(t, status, http.StatusNotFound)
+	})
+}
+
+func TestUserPasswordForgot(t *testing.T) {
+	app := newTestApplication(t)
+
+	// keep the emails that would have been sent
+	sent := new(bytes.Buffer)
+	app.mailer = &mailer.Log{Logger: log.New(sent, "", 0)}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		email     string
+		wantCode  int
+		wantEmail string
+	}{
+		{
+			name:      "Known email",
+			email:     "alice@example.com",
+			wantCode:  http.StatusSeeOther,
+			wantEmail: "https://snippetbox.test/user/password/reset/RESETTOKEN",
+		},
+		{
+			name:     "Unknown email",
+			email:    "nobody@example.com",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid email",
+			email:    "alice@",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent.Reset()
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/user/password/forgot", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			// the email goes out after the response
+			app.background.Wait()
+
+			if tt.wantEmail != "" {
+				assert.StringContains(t, sent.String(), tt.wantEmail)
+			} else {
+				assert.Equal(t, sent.Len(), 0)
+			}
+		})
+	}
+}
+
+func TestUserPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Invalid link", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/user/password/reset/EXPIRED")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/password/forgot")
+	})
+
+	code, _, body := ts.get(t, "/user/password/reset/RESETTOKEN")
+	assert.Equal(t, code, http.StatusOK)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		password     string
+		confirmation string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Mismatched confirmation",
+			urlPath:      "/user/password/reset/RESETTOKEN",
+			password:     "n3w pa$$word",
+			confirmation: "something else",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Short password",
+			urlPath:      "/user/password/reset/RESETTOKEN",
+			password:     "pa$$",
+			confirmation: "pa$$",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Used or expired token",
+			urlPath:      "/user/password/reset/EXPIRED",
+			password:     "n3w pa$$word",
+			confirmation: "n3w pa$$word",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/password/forgot",
+		},
+		{
+			name:         "Valid submission",
+			urlPath:      "/user/password/reset/RESETTOKEN",
+			password:     "n3w pa$$word",
+			confirmation: "n3w pa$$word",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("new password", tt.password)
+			form.Add("confirm password", tt.confirmation)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantLocation != "" {
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestUserVerify(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	valid := app.verificationToken(1, "alice@example.com", time.Now().Add(time.Hour))
+	expired := app.verificationToken(1, "alice@example.com", time.Now().Add(-time.Hour))
+	oldEmail := app.verificationToken(1, "alice@old.example.com", time.Now().Add(time.Hour))
+
+	// sign the same payload with a different key
+	forger := newTestApplication(t)
+	forger.secretKey = []byte("another secret")
+	forged := forger.verificationToken(1, "alice@example.com", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name         string
+		token        string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Valid token",
+			token:        valid,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Expired token",
+			token:        expired,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+		{
+			name:         "Address changed since",
+			token:        oldEmail,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+		{
+			name:         "Forged token",
+			token:        forged,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+		{
+			name:         "Garbage token",
+			token:        "not-a-token",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.get(t, "/user/verify/"+tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestUserVerifyResend(t *testing.T) {
+	app := newTestApplication(t)
+
+	sent := new(bytes.Buffer)
+	app.mailer = &mailer.Log{Logger: log.New(sent, "", 0)}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unverified user", func(t *testing.T) {
+		csrfToken := ts.loginAs(t, "bob@example.com")
+		sent.Reset()
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/user/verify/resend", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.StringContains(t, sent.String(), "https://snippetbox.test/user/verify/")
+	})
+
+	t.Run("Verified user", func(t *testing.T) {
+		csrfToken := ts.login(t)
+		sent.Reset()
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/user/verify/resend", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, sent.Len(), 0)
+	})
+}
+
+func TestRequireVerification(t *testing.T) {
+	tests := []struct {
+		name         string
+		required     bool
+		email        string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "Policy off",
+			email:    "bob@example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "Unverified user",
+			required:     true,
+			email:        "bob@example.com",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/view",
+		},
+		{
+			name:     "Verified user",
+			required: true,
+			email:    "alice@example.com",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.verificationRequired = tt.required
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.loginAs(t, tt.email)
+			code, header, _ := ts.get(t, "/snippet/create")
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestUserLoginTwoFactor(t *testing.T) {
+	validCode, err := totp.GenerateCode(mocks.TOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Valid TOTP code",
+			code:         validCode,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/view",
+		},
+		{
+			name:         "Valid recovery code",
+			code:         mocks.RecoveryCode,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/view",
+		},
+		{
+			name:     "Wrong code",
+			code:     "000000",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Empty code",
+			code:     "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+			csrfToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("email", "carol@example.com")
+			form.Add("password", "pa$$word")
+			form.Add("csrf_token", csrfToken)
+			code, header, _ := ts.postForm(t, "/user/login", form)
+
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login/2fa")
+
+			// the password alone doesn't log the user in, the page they
+			// tried to reach is where they end up after the second step
+			code, header, _ = ts.get(t, "/account/view")
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+
+			form = url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", csrfToken)
+			code, header, _ = ts.postForm(t, "/user/login/2fa", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Too many wrong codes", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		csrfToken := ts.loginAs(t, "carol@example.com")
+
+		form := url.Values{}
+		form.Add("code", "000000")
+		form.Add("csrf_token", csrfToken)
+
+		for i := 1; i < twoFactorMaxAttempts; i++ {
+			code, _, _ := ts.postForm(t, "/user/login/2fa", form)
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		code, header, _ := ts.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+
+		// the pending login is gone, even the right code doesn't help now
+		form.Set("code", validCode)
+		_, header, _ = ts.postForm(t, "/user/login/2fa", form)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+}
+
+func TestUserLoginTwoFactorReplay(t *testing.T) {
+	app := newTestApplication(t)
+
+	validCode, err := totp.GenerateCode(mocks.TOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// log in as carol from a fresh browser with the same code every time
+	logIn := func(t *testing.T) int {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		csrfToken := ts.loginAs(t, "carol@example.com")
+
+		form := url.Values{}
+		form.Add("code", validCode)
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/user/login/2fa", form)
+		return code
+	}
+
+	assert.Equal(t, logIn(t), http.StatusSeeOther)
+
+	// the code is still within its validity window, but already used
+	assert.Equal(t, logIn(t), http.StatusUnprocessableEntity)
+}
+
+func TestTOTPStep(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	current := now.Unix() / totpPeriod
+
+	code := func(at time.Time) string {
+		c, err := totp.GenerateCode(mocks.TOTPSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current", code: code(now), wantStep: current, wantOK: true},
+		{name: "With spaces", code: code(now)[:3] + " " + code(now)[3:], wantStep: current, wantOK: true},
+		{name: "Previous period", code: code(now.Add(-totpPeriod * time.Second)), wantStep: current - 1, wantOK: true},
+		{name: "Next period", code: code(now.Add(totpPeriod * time.Second)), wantStep: current + 1, wantOK: true},
+		{name: "Too old", code: code(now.Add(-3 * totpPeriod * time.Second)), wantOK: false},
+		{name: "Wrong", code: "000000", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totpStep(tt.code, mocks.TOTPSecret, now)
+
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, step, tt.wantStep)
+		})
+	}
+}
+
+var totpSecretRX = regexp.MustCompile(`Enter this key instead: <code>([A-Z2-7]+)</code>`)
+
+func TestAccountTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	code, _, body := ts.get(t, "/account/2fa")
+	assert.Equal(t, code, http.StatusOK)
+
+	matches := totpSecretRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no TOTP secret found in body")
+	}
+	secret := matches[1]
+
+	t.Run("QR code", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/account/2fa/qr")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "image/png")
+	})
+
+	t.Run("Wrong code", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("code", "000000")
+		form.Add("csrf_token", csrfToken)
+		code, _, body := ts.postForm(t, "/account/2fa/enable", form)
+
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "That code is incorrect")
+	})
+
+	t.Run("Valid code", func(t *testing.T) {
+		validCode, err := totp.GenerateCode(secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form := url.Values{}
+		form.Add("code", validCode)
+		form.Add("csrf_token", csrfToken)
+		code, _, body := ts.postForm(t, "/account/2fa/enable", form)
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<code>aaaaa-bbbbb</code>")
+	})
+}
+
+func TestAccountTwoFactorDisable(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode int
+	}{
+		{
+			name:     "Wrong password",
+			password: "wrong",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Valid password",
+			password: "pa$$word",
+			wantCode: http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := ts.postForm(t, "/account/2fa/disable", form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestUserLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	login := func(password string) (int, string) {
+		form := url.Values{}
+		form.Add("email", "alice@example.com")
+		form.Add("password", password)
+		form.Add("csrf_token", validCSRFToken)
+		code, _, body := ts.postForm(t, "/user/login", form)
+		return code, body
+	}
+
+	// the free attempts, then one more that starts the lockout
+	for i := 0; i <= accountLockout.Threshold; i++ {
+		code, body := login("wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Email or password is incorrect")
+	}
+
+	t.Run("Locked out", func(t *testing.T) {
+		code, body := login("pa$$word")
+
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.StringContains(t, body, "Too many failed login attempts. Please try again in a minute")
+	})
+
+	t.Run("Other accounts unaffected", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("email", "bob@example.com")
+		form.Add("password", "pa$$word")
+		form.Add("csrf_token", validCSRFToken)
+		code, _, _ := ts.postForm(t, "/user/login", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+
+	t.Run("Unlocked by a password reset", func(t *testing.T) {
+		_, _, body := ts.get(t, "/user/password/reset/RESETTOKEN")
+
+		form := url.Values{}
+		form.Add("new password", "n3w pa$$word")
+		form.Add("confirm password", "n3w pa$$word")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, _, _ := ts.postForm(t, "/user/password/reset/RESETTOKEN", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		_, _, body = ts.get(t, "/user/login")
+		validCSRFToken = extractCSRFToken(t, body)
+
+		code, _ = login("pa$$word")
+		assert.Equal(t, code, http.StatusSeeOther)
+	})
+}
+
+func TestTooManyAttempts(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{wait: 10 * time.Second, want: "try again in a minute"},
+		{wait: time.Minute, want: "try again in a minute"},
+		{wait: 61 * time.Second, want: "try again in 2 minutes"},
+		{wait: time.Hour, want: "try again in 60 minutes"},
+	}
+
+	for _, tt := range tests {
+		assert.StringContains(t, tooManyAttempts(tt.wait), tt.want)
+	}
+}
+
+var revokeSessionRX = regexp.MustCompile(`/account/sessions/revoke/(\d+)`)
+
+func TestAccountSessions(t *testing.T) {
+	app := newTestApplication(t)
+
+	// two clients with their own cookies, like two browsers
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+
+	loggedIn := func(ts *testServer) bool {
+		code, _, _ := ts.get(t, "/account/view")
+		return code == http.StatusOK
+	}
+
+	csrfToken := ts.login(t)
+
+	t.Run("Log out one session", func(t *testing.T) {
+		other.login(t)
+
+		code, _, body := ts.get(t, "/account/sessions")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "This session")
+
+		matches := revokeSessionRX.FindStringSubmatch(body)
+		if len(matches) < 2 {
+			t.Fatal("no session to revoke found in body")
+		}
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ = ts.postForm(t, "/account/sessions/revoke/"+matches[1], form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, loggedIn(other), false)
+		assert.Equal(t, loggedIn(ts), true)
+	})
+
+	t.Run("Log out everywhere else", func(t *testing.T) {
+		other.login(t)
+		assert.Equal(t, loggedIn(other), true)
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/account/sessions/revoke-others", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, loggedIn(other), false)
+		assert.Equal(t, loggedIn(ts), true)
+	})
+
+	t.Run("Unknown session", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/account/sessions/revoke/999", form)
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Log out this session", func(t *testing.T) {
+		otherCSRFToken := other.login(t)
+
+		// the page has no button for it, but the form can still be posted
+		sessions, err := app.sessions.ForUser(1)
+		assert.NilError(t, err)
+		current := sessions[len(sessions)-1].ID
+
+		form := url.Values{}
+		form.Add("csrf_token", otherCSRFToken)
+		code, header, _ := other.postForm(t, fmt.Sprintf("/account/sessions/revoke/%d", current), form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/")
+		assert.Equal(t, loggedIn(other), false)
+		assert.Equal(t, loggedIn(ts), true)
+	})
+
+	t.Run("Password change logs out other sessions", func(t *testing.T) {
+		other.login(t)
+
+		form := url.Values{}
+		form.Add("old password", "pa$$word")
+		form.Add("new password", "n3w pa$$word")
+		form.Add("confirm password", "n3w pa$$word")
+		form.Add("csrf_token", csrfToken)
+		code, _, _ := ts.postForm(t, "/account/password/update", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, loggedIn(other), false)
+		assert.Equal(t, loggedIn(ts), true)
+
+		// and the current session is still listed under its new token
+		_, _, body := ts.get(t, "/account/sessions")
+		assert.StringContains(t, body, "This session")
+	})
+}
+
+func TestAccountExport(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	t.Run("JSON", func(t *testing.T) {
+		code, header, body := ts.get(t, "/account/export")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "application/json")
+		assert.Equal(t, header.Get("Content-Disposition"), `attachment; filename=snippetbox-export.json`)
+		assert.StringContains(t, body, `"email": "alice@example.com"`)
+		assert.StringContains(t, body, `"content": "An old silent pond..."`)
+	})
+
+	t.Run("ZIP", func(t *testing.T) {
+		code, header, body := ts.get(t, "/account/export?format=zip")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "application/zip")
+
+		archive, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+		assert.NilError(t, err)
+
+		names := []string{}
+		for _, f := range archive.File {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, strings.Join(names, " "), "account.json snippets/Xq3vR8tLm2Pk-an-old-silent-pond.txt")
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/account/export?format=xml")
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+}
+
+func TestAccountDelete(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+
+	csrfToken := ts.login(t)
+	other.login(t)
+
+	t.Run("Wrong password", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("password", "wrong")
+		form.Add("csrf_token", csrfToken)
+		code, _, body := ts.postForm(t, "/account/delete", form)
+
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Password is incorrect")
+	})
+
+	t.Run("Valid password", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("password", "pa$$word")
+		form.Add("csrf_token", csrfToken)
+		code, header, _ := ts.postForm(t, "/account/delete", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/")
+
+		// both sessions are logged out
+		for _, client := range []*testServer{ts, other} {
+			code, header, _ := client.get(t, "/account/view")
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+		}
+	})
+}
+
+func TestAccountProfile(t *testing.T) {
+	app := newTestApplication(t)
+
+	sent := new(bytes.Buffer)
+	app.mailer = &mailer.Log{Logger: log.New(sent, "", 0)}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t)
+
+	t.Run("Form is prefilled", func(t *testing.T) {
+		code, _, body := ts.get(t, "/account/profile")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "value='alice@example.com'")
+	})
+
+	tests := []struct {
+		name      string
+		userName  string
+		email     string
+		password  string
+		wantCode  int
+		wantBody  string
+		wantEmail string
+	}{
+		{
+			name:     "Change name only",
+			userName: "Alice Jones",
+			email:    "alice@example.com",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Change case of email",
+			userName: "Alice Jones",
+			email:    "Alice@Example.com",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:      "Change email",
+			userName:  "Alice",
+			email:     "alice@new.example.com",
+			password:  "pa$$word",
+			wantCode:  http.StatusSeeOther,
+			wantEmail: "https://snippetbox.test/user/verify/",
+		},
+		{
+			name:     "Change email without password",
+			userName: "Alice",
+			email:    "alice@new.example.com",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Enter your password to change your email address",
+		},
+		{
+			name:     "Change email with wrong password",
+			userName: "Alice",
+			email:    "alice@new.example.com",
+			password: "wrong",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Password is incorrect",
+		},
+		{
+			name:     "Email of another user",
+			userName: "Alice",
+			email:    "bob@example.com",
+			password: "pa$$word",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Email address is already in use",
+		},
+		{
+			name:     "Invalid email",
+			userName: "Alice",
+			email:    "alice@",
+			password: "pa$$word",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a valid email address",
+		},
+		{
+			name:     "Blank name",
+			userName: "  ",
+			email:    "alice@example.com",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent.Reset()
+
+			form := url.Values{}
+			form.Add("name", tt.userName)
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := ts.postForm(t, "/account/profile", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+
+			// the emails go out after the response
+			app.background.Wait()
+
+			if tt.wantEmail != "" {
+				assert.StringContains(t, sent.String(), tt.wantEmail)
+				// and the old address is told about it
+				assert.StringContains(t, sent.String(), "was changed to "+tt.email)
+			} else {
+				assert.Equal(t, sent.Len(), 0)
+			}
+		})
+	}
+
+	t.Run("Mail server down", func(t *testing.T) {
+		app.mailer = failingMailer{}
+		defer func() { app.mailer = &mailer.Log{Logger: log.New(sent, "", 0)} }()
+
+		form := url.Values{}
+		form.Add("name", "Alice")
+		form.Add("email", "alice@new.example.com")
+		form.Add("password", "pa$$word")
+		form.Add("csrf_token", csrfToken)
+		code, header, _ := ts.postForm(t, "/account/profile", form)
+		app.background.Wait()
+
+		// the change is saved regardless, so it isn't reported as failed
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/account/view")
+	})
+}
+
+// a mailer whose server can't be reached
+type failingMailer struct{}
+
+func (failingMailer) Send(recipient, subject, body string) error {
+	return errors.New("connection refused")
+}
@@ -2,16 +2,49 @@ package main
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"snippetbox.opre.net/internal/lockout"
+	"snippetbox.opre.net/internal/models"
+	"snippetbox.opre.net/internal/syntax"
 )
 
+// Run fn in its own goroutine, so the response doesn't wait for it. Errors
+// and panics are logged since there is no request left to fail, and shutdown
+// waits for fn to finish.
+func (app *application) runBackground(fn func() error) {
+	app.background.Add(1)
+
+	go func() {
+		defer app.background.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.errLog.Printf("background task: %v", err)
+			}
+		}()
+
+		err := fn()
+		if err != nil {
+			app.errLog.Print(err)
+		}
+	}()
+}
+
 // Help send out server error messages
 func (app *application) serverError(w http.ResponseWriter, err error) {
 	// print error message to log or write as request response if in debug mode
@@ -67,7 +100,7 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	// return template data to be used by app durinh current session
-	return &templateData{
+	data := &templateData{
 		CurrentYear: time.Now().Year(),
 		// acts like a one-time fetch. If there is no matching key in the session
 		// data this will return the empty string.
@@ -75,6 +108,13 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 		IsAuthenticated: app.isAuthenticated(r),
 		CSRFToken:       nosurf.Token(r),
 	}
+
+	// only expose the user ID once the authenticate middleware has vouched for it
+	if data.IsAuthenticated {
+		data.AuthenticatedUserID = app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	}
+
+	return data
 }
 
 func (app *application) decodePostForm(r *http.Request, dst any) error {
@@ -105,6 +145,455 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// how long the links in password reset emails stay valid
+const passwordResetTTL = time.Hour
+
+// Send the user back to request a new reset link
+func (app *application) invalidResetLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "That password reset link is invalid or has expired. Please request a new one.")
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
+
+// How failed logins lock an account or IP address out. An account gets a few
+// tries before each failure doubles the wait, an IP address gets more since
+// many users can share one.
+var (
+	accountLockout = lockout.Policy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	ipLockout      = lockout.Policy{Threshold: 20, BaseDelay: time.Minute, MaxDelay: time.Hour}
+)
+
+// the key failed logins of an account are counted under
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// the key failed logins from the client's IP address are counted under
+func (app *application) ipKey(r *http.Request) string {
+	return "ip:" + app.clientIP(r)
+}
+
+// Returns how much longer logins to the account, or from the client's IP
+// address, are locked out for. 0 means the login may go ahead.
+func (app *application) loginWait(r *http.Request, email string) (time.Duration, error) {
+	accountWait, err := app.loginAccounts.Wait(accountKey(email))
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait, err := app.loginIPs.Wait(app.ipKey(r))
+	if err != nil {
+		return 0, err
+	}
+
+	return max(accountWait, ipWait), nil
+}
+
+// record a failed login against both the account and the IP address
+func (app *application) loginFailed(r *http.Request, email string) error {
+	err := app.loginAccounts.Fail(accountKey(email))
+	if err != nil {
+		return err
+	}
+	return app.loginIPs.Fail(app.ipKey(r))
+}
+
+// Describes a lockout to the user, e.g. "Too many failed login attempts.
+// Please try again in 4 minutes."
+func tooManyAttempts(wait time.Duration) string {
+	after := "a minute"
+
+	// round up, so the user doesn't come back too early
+	minutes := int((wait + time.Minute - 1) / time.Minute)
+	if minutes > 1 {
+		after = fmt.Sprintf("%d minutes", minutes)
+	}
+
+	return "Too many failed login attempts. Please try again in " + after + ", or reset your password."
+}
+
+// Log the user in by putting their ID in a renewed session, then send them
+// on to the page they were trying to reach
+func (app *application) logIn(w http.ResponseWriter, r *http.Request, id int) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Add the ID of the current user to the session, so that they are now
+	// 'logged in'.
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+
+	err = app.trackSession(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+
+	// Check what path the user tried to access before logging in,
+	//  Redirect them to that path
+	if path != "" {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+	// Redirect the user to the create snippet page.
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// Record the current session as one of the user's, so it shows up on their
+// sessions page. Must be called after the session token was renewed.
+func (app *application) trackSession(r *http.Request, userID int) error {
+	err := app.sessions.Insert(userID, app.sessionManager.Token(r.Context()),
+		app.clientIP(r), r.UserAgent(), app.sessionManager.Deadline(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	// it was just seen, so the next requests needn't touch it
+	app.sessionManager.Put(r.Context(), "sessionTouched", time.Now().Unix())
+	return nil
+}
+
+// Delete the data of the given sessions, logging them out
+func (app *application) revokeSessions(tokens []string) error {
+	for _, token := range tokens {
+		err := app.sessionManager.Store.Delete(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// how long the second login step waits for a code, and how many wrong codes
+// it accepts before the user has to start over
+const (
+	twoFactorLoginTTL    = 5 * time.Minute
+	twoFactorMaxAttempts = 5
+)
+
+// Returns the ID of the user who entered the right password but still has to
+// enter a two-factor code, or 0 if there is none
+func (app *application) twoFactorUserID(r *http.Request) int {
+	started := app.sessionManager.GetInt64(r.Context(), "twoFactorStarted")
+	if time.Since(time.Unix(started, 0)) > twoFactorLoginTTL {
+		return 0
+	}
+	return app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+}
+
+// forget about a pending two-factor login
+func (app *application) clearTwoFactor(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorStarted")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+}
+
+// TOTP codes change every totpPeriod, and codes from totpSkew periods either
+// side of the current one are accepted to allow for clock drift. These are
+// the defaults of authenticator apps and of totp.Validate()
+const (
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+// Check a TOTP code against the secret and return the time step, the number
+// of periods since the Unix epoch, it belongs to. Callers have to make sure
+// the step wasn't used before.
+func totpStep(code, secret string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the TOTP key the user is enrolling, kept in the session by
+// accountTwoFactor() until the first code confirms it
+func (app *application) pendingTwoFactorKey(r *http.Request) (*otp.Key, error) {
+	url := app.sessionManager.GetString(r.Context(), "twoFactorKey")
+	if url == "" {
+		return nil, errors.New("no two-factor enrollment in progress")
+	}
+	return otp.NewKeyFromURL(url)
+}
+
+// Render the API tokens page with the user's tokens and the given form
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form apiTokenCreateForm) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tokens, err := app.tokens.ForUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = app.sessionManager.PopString(r.Context(), "newToken")
+	data.Form = form
+
+	app.render(w, status, "tokens.tmpl.html", data)
+}
+
+// Find the snippet an :id parameter refers to on behalf of a viewer, 0 for
+// anonymous visitors. Snippets are looked up by slug, while numeric IDs from
+// before slugs existed only find public snippets and the viewer's own, so they
+// can't be used to walk through the unlisted ones. Reports whether the
+// parameter was a numeric ID, and ErrNoRecord for anything the viewer may not
+// see.
+func (app *application) findSnippet(param string, userID int) (*models.Snippet, bool, error) {
+	if len(param) != models.SlugLength {
+		id, err := strconv.Atoi(param)
+		if err != nil || id < 1 {
+			return nil, false, models.ErrNoRecord
+		}
+
+		snippet, err := app.snippets.Get(id)
+		if err != nil {
+			return nil, true, err
+		}
+
+		if snippet.Visibility != models.VisibilityPublic && (userID == 0 || userID != snippet.UserID) {
+			return nil, true, models.ErrNoRecord
+		}
+
+		return snippet, true, nil
+	}
+
+	snippet, err := app.snippets.GetBySlug(param)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// pretend private snippets don't exist, so their slugs can't be probed
+	if !snippet.VisibleTo(userID) {
+		return nil, false, models.ErrNoRecord
+	}
+
+	return snippet, false, nil
+}
+
+// Look up the snippet named by the :id parameter for display. Old numeric
+// URLs are permanently redirected to the slug URL. Responds with 404 (or the
+// redirect) and returns false otherwise.
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	param := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	snippet, legacy, err := app.findSnippet(param, app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	// swap the ID for the slug wherever it sits in the path, keeping any
+	// trailing segments such as /history and the query string. Browsers
+	// follow a 301 with a GET, so forms are redirected with a 308 instead
+	if legacy {
+		target := *r.URL
+		target.Path = strings.Replace(target.Path, "/"+param, "/"+snippet.Slug, 1)
+
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+
+		http.Redirect(w, r, target.String(), status)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// How many unlocked snippets a session remembers before forgetting the oldest
+const maxUnlockedSnippets = 20
+
+// Reports whether a snippet is password protected and hasn't been unlocked in
+// this session yet. Owners never need the password.
+func (app *application) snippetLocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.Protected {
+		return false
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID != 0 && userID == snippet.UserID {
+		return false
+	}
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]int)
+	return !slices.Contains(unlocked, snippet.ID)
+}
+
+// Reports whether viewing a snippet counts against its view limit, which it
+// doesn't for unlimited snippets or their owner
+func (app *application) viewCounted(r *http.Request, snippet *models.Snippet) bool {
+	if snippet.ViewsLeft == 0 {
+		return false
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	return userID == 0 || userID != snippet.UserID
+}
+
+// Remember in the session that a protected snippet has been unlocked
+func (app *application) unlockSnippet(r *http.Request, id int) {
+	unlocked, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]int)
+
+	unlocked = append(unlocked, id)
+	if len(unlocked) > maxUnlockedSnippets {
+		unlocked = unlocked[len(unlocked)-maxUnlockedSnippets:]
+	}
+
+	app.sessionManager.Put(r.Context(), "unlockedSnippets", unlocked)
+}
+
+// Resolve the slug, or numeric ID from before slugs existed, of a snippet
+// about to be changed by the given user to its ID. Expired snippets count too,
+// so owners can still delete them. Returns ErrNoRecord for other users'
+// snippets as well, so nobody can probe which slugs or IDs exist.
+func (app *application) snippetOwner(param string, userID int) (int, error) {
+	var id, ownerID int
+	var err error
+
+	if len(param) == models.SlugLength {
+		id, ownerID, err = app.snippets.OwnerBySlug(param)
+	} else {
+		id, err = strconv.Atoi(param)
+		if err != nil || id < 1 {
+			return 0, models.ErrNoRecord
+		}
+		ownerID, err = app.snippets.Owner(id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if userID == 0 || ownerID != userID {
+		return 0, models.ErrNoRecord
+	}
+
+	return id, nil
+}
+
+// Check that the snippet named by the :id parameter belongs to the logged in
+// user and return its ID. Responds with 404 and returns false otherwise.
+func (app *application) ownedSnippetID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	id, err := app.snippetOwner(httprouter.ParamsFromContext(r.Context()).ByName("id"), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Like ownedSnippetID() but also fetches the (unexpired) snippet itself
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	return app.fetchOwnedSnippet(w, r, app.snippets.Get)
+}
+
+// Like ownedSnippet() but finds snippets that have expired and not been
+// purged yet as well, so their owners can still extend them
+func (app *application) ownedSnippetIncludingExpired(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	return app.fetchOwnedSnippet(w, r, app.snippets.GetIncludingExpired)
+}
+
+func (app *application) fetchOwnedSnippet(w http.ResponseWriter, r *http.Request, get func(id int) (*models.Snippet, error)) (*models.Snippet, bool) {
+	id, ok := app.ownedSnippetID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	snippet, err := get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundError(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// How many unchanged lines are shown around every change in a revision diff
+const diffContext = 3
+
+// Pick the revision with the number given as a query parameter, or fallback
+// when the parameter is missing or names no revision
+func findRevision(revisions []*models.Revision, param string, fallback *models.Revision) *models.Revision {
+	number, err := strconv.Atoi(param)
+	if err != nil {
+		return fallback
+	}
+
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return revision
+		}
+	}
+
+	return fallback
+}
+
+// Split a comma separated list of tags into lowercase tag names, dropping
+// blanks and duplicates while keeping the order they were entered in
+func parseTags(input string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+var filenameRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Build a download filename from the snippet title and language, falling back
+// to the snippet ID for titles without any usable characters
+func snippetFilename(snippet *models.Snippet) string {
+	name := strings.Trim(filenameRX.ReplaceAllString(strings.ToLower(snippet.Title), "-"), "-")
+	if len(name) > 50 {
+		name = strings.TrimRight(name[:50], "-")
+	}
+	if name == "" {
+		name = "snippet-" + snippet.Slug
+	}
+
+	return name + syntax.Extension(snippet.Language)
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	// Checks if the user making the request is logged in or not
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
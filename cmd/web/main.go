@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"snippetbox.opre.net/internal/lockout"
+	"snippetbox.opre.net/internal/mailer"
 	"snippetbox.opre.net/internal/models"
 
 	"github.com/alexedwards/scs/mysqlstore"
@@ -27,7 +37,28 @@ type application struct {
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 	users          models.UserModelInterface
-	debugMode      bool
+	tokens         models.TokenModelInterface
+	resets         models.PasswordResetModelInterface
+	twoFactor      models.TwoFactorModelInterface
+	sessions       models.SessionModelInterface
+	loginAccounts  *lockout.Limiter
+	loginIPs       *lockout.Limiter
+	rateLimits     *rateLimits
+	trustedProxies []*net.IPNet
+	mailer         mailer.Mailer
+	baseURL        string
+	secretKey      []byte
+	// when set, users must confirm their email address before they can
+	// create, edit or delete snippets
+	verificationRequired bool
+	// what happens to the snippets of deleted accounts, deletedSnippetsDelete
+	// or deletedSnippetsAnonymize
+	deletedSnippets string
+	// longest a snippet may be kept after it was created, 0 for no limit
+	maxLifetime time.Duration
+	// goroutines shutdown has to wait for, see runBackground()
+	background sync.WaitGroup
+	debugMode  bool
 }
 
 func main() {
@@ -44,8 +75,80 @@ func main() {
 
 	debugMode := flag.Bool("debug", false, "Start the server in debug mode.")
 
+	// public address of the site, used to build links in emails
+	baseURL := flag.String("base-url", "https://localhost:4000", "The URL users reach the server at")
+
+	// SMTP server used to send emails, when no host is given emails are
+	// written to the info log instead
+	smtpHost := flag.String("smtp-host", "", "SMTP server host")
+	smtpPort := flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Snippetbox <no-reply@snippetbox.opre.net>", "SMTP sender")
+
+	// key used to sign email verification links, a random one is generated
+	// when none is given but links then stop working on restart
+	secret := flag.String("secret", "", "Secret key used to sign links")
+
+	requireVerification := flag.Bool("require-verification", false, "Only let users with a confirmed email address create snippets")
+
+	// request budgets per client IP address, see ratelimit.go
+	var readBudget, writeBudget, authBudget budget
+	flag.Float64Var(&readBudget.PerMinute, "limit-read", 300, "Requests per minute a client may make")
+	flag.IntVar(&readBudget.Burst, "limit-read-burst", 60, "Requests a client may make in a burst")
+	flag.Float64Var(&writeBudget.PerMinute, "limit-write", 6, "Write requests per minute a client may make, such as creating, editing or deleting snippets")
+	flag.IntVar(&writeBudget.Burst, "limit-write-burst", 10, "Write requests a client may make in a burst")
+	flag.Float64Var(&authBudget.PerMinute, "limit-auth", 10, "Logins, signups and password resets per minute a client may attempt")
+	flag.IntVar(&authBudget.Burst, "limit-auth-burst", 10, "Logins, signups and password resets a client may attempt in a burst")
+	limitEnabled := flag.Bool("limit-enabled", true, "Enable rate limiting")
+
+	// proxies in front of the server whose X-Forwarded-For headers can be
+	// believed
+	trustedProxyList := flag.String("trusted-proxies", "", "Comma separated IP addresses or CIDR ranges of trusted reverse proxies")
+
+	deletedSnippets := flag.String("deleted-snippets", deletedSnippetsDelete, `What happens to the snippets of deleted accounts, "delete" or "anonymize"`)
+
+	maxLifetime := flag.Duration("max-lifetime", 0, "Longest time a snippet may be kept, e.g. 720h, 0 allows snippets that never expire")
+
+	// expired snippets are deleted in the background, after a grace period in
+	// which their owners can still see them
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "How often to delete expired snippets and sessions, 0 to never delete them")
+	purgeRetention := flag.Duration("purge-retention", 7*24*time.Hour, "How long to keep snippets after they expire")
+
 	flag.Parse()
 
+	if *deletedSnippets != deletedSnippetsDelete && *deletedSnippets != deletedSnippetsAnonymize {
+		errLog.Fatalf("invalid -deleted-snippets %q", *deletedSnippets)
+	}
+
+	if *maxLifetime < 0 {
+		errLog.Fatalf("invalid -max-lifetime %s", *maxLifetime)
+	}
+
+	if *purgeInterval < 0 || *purgeRetention < 0 {
+		errLog.Fatalf("invalid -purge-interval %s or -purge-retention %s", *purgeInterval, *purgeRetention)
+	}
+
+	trustedProxies, err := parseTrustedProxies(*trustedProxyList)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	var limits *rateLimits
+	if *limitEnabled {
+		limits = newRateLimits(readBudget, writeBudget, authBudget)
+	}
+
+	secretKey := []byte(*secret)
+	if len(secretKey) == 0 {
+		secretKey = make([]byte, 32)
+		_, err := rand.Read(secretKey)
+		if err != nil {
+			errLog.Fatal(err)
+		}
+		infoLog.Print("No -secret given, verification links will stop working on restart")
+	}
+
 	// open MySQL database
 	db, err := openDB(*dsn)
 
@@ -73,6 +176,21 @@ func main() {
 	// Initialize a decoder instance...
 	formDecoder := form.NewDecoder()
 
+	var mail mailer.Mailer = &mailer.Log{Logger: infoLog}
+	if *smtpHost != "" {
+		mail = &mailer.SMTP{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			Sender:   *smtpSender,
+		}
+	}
+
+	// failed logins are counted per account and per IP address, a counter is
+	// forgotten after a day without failures
+	lockoutStore := lockout.NewMemory(24 * time.Hour)
+
 	// create backend app
 	app := &application{
 		// create new loggers for info and errors
@@ -83,7 +201,22 @@ func main() {
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 		users:          &models.UserModel{DB: db},
-		debugMode:      *debugMode,
+		tokens:         &models.TokenModel{DB: db},
+		resets:         &models.PasswordResetModel{DB: db},
+		twoFactor:      &models.TwoFactorModel{DB: db},
+		sessions:       &models.SessionModel{DB: db},
+		loginAccounts:  lockout.New(lockoutStore, accountLockout),
+		loginIPs:       lockout.New(lockoutStore, ipLockout),
+		rateLimits:     limits,
+		trustedProxies: trustedProxies,
+		mailer:         mail,
+		baseURL:        strings.TrimSuffix(*baseURL, "/"),
+		secretKey:      secretKey,
+
+		verificationRequired: *requireVerification,
+		deletedSnippets:      *deletedSnippets,
+		maxLifetime:          *maxLifetime,
+		debugMode:            *debugMode,
 	}
 
 	// Initialize a tls.Config struct to hold the non-default TLS settings we
@@ -105,10 +238,44 @@ func main() {
 
 	defer server.Close()
 
+	// cancelled on SIGINT or SIGTERM, which stops the server and background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *purgeInterval > 0 {
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			app.purge(ctx, *purgeInterval, *purgeRetention)
+		}()
+	}
+
+	// let requests in flight finish before shutting down
+	shutdownErr := make(chan error)
+	go func() {
+		<-ctx.Done()
+		infoLog.Print("Shutting down server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shutdownErr <- server.Shutdown(shutdownCtx)
+	}()
+
 	infoLog.Printf("Starting server on %s", *address)
 
 	err = server.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errLog.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		errLog.Fatal(err)
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	app.background.Wait()
+	infoLog.Print("Server stopped")
 }
 
 func openDB(dsn string) (*sql.DB, error) {
@@ -2,12 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"snippetbox.opre.net/internal/models"
 )
 
+// how often a logged in session's last use is recorded, the sessions page
+// doesn't need to be more precise than that
+const sessionTouchInterval = time.Minute
+
 func secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Security-Policy",
@@ -62,6 +72,32 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// Send users who haven't confirmed their email address back to their account
+// page, when the server is configured to require it. Must come after
+// requireAuthentication.
+func (app *application) requireVerification(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.verificationRequired {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if !user.Verified {
+			app.sessionManager.Put(r.Context(), "flash", "Please confirm your email address before working on snippets.")
+			http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
@@ -100,6 +136,153 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		if exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
 			r = r.WithContext(ctx)
+
+			// keep the sessions page up to date, without a write on every
+			// request
+			touched := app.sessionManager.GetInt64(r.Context(), "sessionTouched")
+			if time.Since(time.Unix(touched, 0)) >= sessionTouchInterval {
+				err = app.sessions.Touch(app.sessionManager.Token(r.Context()), app.clientIP(r))
+				if err != nil {
+					app.serverError(w, err)
+					return
+				}
+				app.sessionManager.Put(r.Context(), "sessionTouched", time.Now().Unix())
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authenticate API requests using HTTP basic auth with the user's email and
+// password. API clients don't use the session cookie, so the user ID is kept
+// in the request context instead. Requests without credentials carry on
+// anonymously.
+func (app *application) authenticateAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// basic auth is as open to password guessing as the login form, so
+		// the same lockouts apply
+		wait, err := app.loginWait(r, email)
+		if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			app.writeJSON(w, http.StatusTooManyRequests, apiError{Error: tooManyAttempts(wait)})
+			return
+		}
+
+		id, err := app.users.Authenticate(email, password)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				err = app.loginFailed(r, email)
+				if err != nil {
+					app.apiServerError(w, err)
+					return
+				}
+				app.apiUnauthorized(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		// a password alone isn't enough for accounts with two-factor
+		// authentication, those have to use API tokens
+		_, err = app.twoFactor.Get(id)
+		if err == nil {
+			app.apiUnauthorized(w)
+			return
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.apiServerError(w, err)
+			return
+		}
+
+		err = app.loginAccounts.Reset(accountKey(email))
+		if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		// a password grants full access
+		next.ServeHTTP(w, app.withAPIUser(r, id, models.ScopeReadWrite))
+	})
+}
+
+// Authenticate API requests carrying a personal API token in an
+// "Authorization: Bearer <token>" header. Requests without one carry on
+// untouched.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plaintext, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(strings.TrimSpace(plaintext))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiUnauthorized(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, app.withAPIUser(r, token.UserID, token.Scope))
+	})
+}
+
+// Reject API requests whose credentials only allow reading
+func (app *application) requireWriteScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, _ := r.Context().Value(scopeContextKey).(string)
+		if scope != models.ScopeReadWrite {
+			app.writeJSON(w, http.StatusForbidden, apiError{Error: "This token is read-only"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reject API requests that weren't authenticated by authenticateAPI()
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.apiUserID(r) == 0 {
+			app.apiUnauthorized(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The API counterpart of requireVerification()
+func (app *application) requireAPIVerification(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.verificationRequired {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.users.Get(app.apiUserID(r))
+		if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		if !user.Verified {
+			app.writeJSON(w, http.StatusForbidden, apiError{Error: "Please confirm your email address first"})
+			return
 		}
 
 		next.ServeHTTP(w, r)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"snippetbox.opre.net/internal/assert"
+	"snippetbox.opre.net/internal/models/mocks"
 )
 
 func TestSecureHeader(t *testing.T) {
@@ -48,3 +49,33 @@ func TestSecureHeader(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+// a session model counting how often sessions are touched
+type touchCounter struct {
+	*mocks.SessionModel
+	touches int
+}
+
+func (m *touchCounter) Touch(token, ip string) error {
+	m.touches++
+	return m.SessionModel.Touch(token, ip)
+}
+
+func TestAuthenticateTouch(t *testing.T) {
+	app := newTestApplication(t)
+	sessions := &touchCounter{SessionModel: &mocks.SessionModel{}}
+	app.sessions = sessions
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	// the session was just recorded on login, so it needn't be touched again
+	// for a while
+	for i := 0; i < 3; i++ {
+		code, _, _ := ts.get(t, "/account/view")
+		assert.Equal(t, code, http.StatusOK)
+	}
+	assert.Equal(t, sessions.touches, 0)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// number of snippets shown on each page of a listing
+const snippetsPageSize = 10
+
+// highest page that can be requested, far past any real listing but low
+// enough that the offset can't overflow
+const maxPage = 100000
+
+// Holds the position of a page within a listing, used by the "pagination"
+// partial to render previous/next links.
+type pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+	path     string
+	query    url.Values
+}
+
+// create pagination for the page requested through the "page" query
+// parameter, falling back to the first page on missing or invalid input and
+// capping it at maxPage
+func newPagination(r *http.Request, pageSize int) *pagination {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	page = min(page, maxPage)
+
+	return &pagination{
+		Page:     page,
+		PageSize: pageSize,
+		path:     r.URL.Path,
+		query:    r.URL.Query(),
+	}
+}
+
+// Offset returns how many records precede the current page
+func (p *pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// LastPage returns the number of the final page, never less than 1
+func (p *pagination) LastPage() int {
+	if p.Total <= 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p *pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *pagination) HasNext() bool {
+	return p.Page < p.LastPage()
+}
+
+func (p *pagination) PrevURL() string {
+	return p.pageURL(p.Page - 1)
+}
+
+func (p *pagination) NextURL() string {
+	return p.pageURL(p.Page + 1)
+}
+
+// build a link to another page, keeping any other query parameters intact
+func (p *pagination) pageURL(page int) string {
+	query := url.Values{}
+	for key, values := range p.query {
+		query[key] = values
+	}
+	query.Set("page", strconv.Itoa(page))
+
+	return p.path + "?" + query.Encode()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		total      int
+		wantPage   int
+		wantOffset int
+		wantLast   int
+		wantPrev   bool
+		wantNext   bool
+	}{
+		{
+			name:     "No page parameter",
+			target:   "/account/snippets",
+			total:    25,
+			wantPage: 1,
+			wantLast: 3,
+			wantNext: true,
+		},
+		{
+			name:       "Middle page",
+			target:     "/account/snippets?page=2",
+			total:      25,
+			wantPage:   2,
+			wantOffset: 10,
+			wantLast:   3,
+			wantPrev:   true,
+			wantNext:   true,
+		},
+		{
+			name:       "Last page",
+			target:     "/account/snippets?page=3",
+			total:      25,
+			wantPage:   3,
+			wantOffset: 20,
+			wantLast:   3,
+			wantPrev:   true,
+		},
+		{
+			name:     "Invalid page",
+			target:   "/account/snippets?page=foo",
+			total:    25,
+			wantPage: 1,
+			wantLast: 3,
+			wantNext: true,
+		},
+		{
+			name:     "Negative page",
+			target:   "/account/snippets?page=-4",
+			total:    25,
+			wantPage: 1,
+			wantLast: 3,
+			wantNext: true,
+		},
+		{
+			name:       "Huge page",
+			target:     "/account/snippets?page=9223372036854775807",
+			total:      25,
+			wantPage:   maxPage,
+			wantOffset: (maxPage - 1) * 10,
+			wantLast:   3,
+			wantPrev:   true,
+		},
+		{
+			name:     "Empty listing",
+			target:   "/account/snippets",
+			total:    0,
+			wantPage: 1,
+			wantLast: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPagination(httptest.NewRequest("GET", tt.target, nil), 10)
+			p.Total = tt.total
+
+			assert.Equal(t, p.Page, tt.wantPage)
+			assert.Equal(t, p.Offset(), tt.wantOffset)
+			assert.Equal(t, p.LastPage(), tt.wantLast)
+			assert.Equal(t, p.HasPrev(), tt.wantPrev)
+			assert.Equal(t, p.HasNext(), tt.wantNext)
+		})
+	}
+
+	t.Run("Keeps other query parameters", func(t *testing.T) {
+		p := newPagination(httptest.NewRequest("GET", "/search?q=pond&page=2", nil), 10)
+
+		assert.Equal(t, p.NextURL(), "/search?page=3&q=pond")
+		assert.Equal(t, p.PrevURL(), "/search?page=1&q=pond")
+	})
+}
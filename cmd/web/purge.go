@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// how many expired snippets or sessions are deleted per statement, so a large
+// backlog doesn't hold locks on their table for long
+const purgeBatchSize = 500
+
+// Delete snippets that expired more than retention ago and sessions that have
+// expired, once straight away and then every interval, until ctx is cancelled.
+// Meant to run in its own goroutine for as long as the server does.
+func (app *application) purge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := app.purgeExpired(ctx, time.Now().Add(-retention))
+		if err != nil {
+			app.errLog.Printf("purging expired snippets: %v", err)
+		}
+		if deleted > 0 {
+			app.infoLog.Printf("Purged %d expired snippets", deleted)
+		}
+
+		deleted, err = app.purgeSessions(ctx, time.Now())
+		if err != nil {
+			app.errLog.Printf("purging expired sessions: %v", err)
+		}
+		if deleted > 0 {
+			app.infoLog.Printf("Purged %d expired sessions", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete every snippet that expired before the given time, a batch at a time,
+// returning how many were deleted. Stops early when ctx is cancelled.
+func (app *application) purgeExpired(ctx context.Context, before time.Time) (int, error) {
+	return purgeBatches(ctx, func(limit int) (int, error) {
+		return app.snippets.DeleteExpired(before, limit)
+	})
+}
+
+// Forget every session that expired before the given time, the same way.
+func (app *application) purgeSessions(ctx context.Context, before time.Time) (int, error) {
+	return purgeBatches(ctx, func(limit int) (int, error) {
+		return app.sessions.DeleteExpired(before, limit)
+	})
+}
+
+// call deleteBatch until it deletes less than a full batch, returning how many
+// were deleted in total
+func purgeBatches(ctx context.Context, deleteBatch func(limit int) (int, error)) (int, error) {
+	total := 0
+
+	for ctx.Err() == nil {
+		deleted, err := deleteBatch(purgeBatchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+
+		// a short batch means there is nothing left
+		if deleted < purgeBatchSize {
+			break
+		}
+	}
+
+	return total, nil
+}
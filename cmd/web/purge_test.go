@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+	"snippetbox.opre.net/internal/models/mocks"
+)
+
+// a snippet model holding a number of expired snippets, optionally failing
+// once a number of batches have been deleted or calling done once they all are
+type expiredSnippets struct {
+	mocks.SnippetModel
+	left      int
+	batches   int
+	failAfter int
+	done      func()
+}
+
+func (m *expiredSnippets) DeleteExpired(before time.Time, limit int) (int, error) {
+	if m.failAfter > 0 && m.batches == m.failAfter {
+		return 0, errors.New("connection lost")
+	}
+	m.batches++
+
+	deleted := min(m.left, limit)
+	m.left -= deleted
+	if m.left == 0 && m.done != nil {
+		m.done()
+	}
+	return deleted, nil
+}
+
+func TestPurgeExpired(t *testing.T) {
+	t.Run("In batches", func(t *testing.T) {
+		app := newTestApplication(t)
+		snippets := &expiredSnippets{left: 2*purgeBatchSize + 1}
+		app.snippets = snippets
+
+		deleted, err := app.purgeExpired(context.Background(), time.Now())
+
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, 2*purgeBatchSize+1)
+		assert.Equal(t, snippets.batches, 3)
+		assert.Equal(t, snippets.left, 0)
+	})
+
+	t.Run("Nothing expired", func(t *testing.T) {
+		app := newTestApplication(t)
+		snippets := &expiredSnippets{}
+		app.snippets = snippets
+
+		deleted, err := app.purgeExpired(context.Background(), time.Now())
+
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, 0)
+		assert.Equal(t, snippets.batches, 1)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.snippets = &expiredSnippets{left: 3 * purgeBatchSize, failAfter: 1}
+
+		deleted, err := app.purgeExpired(context.Background(), time.Now())
+
+		assert.Equal(t, err != nil, true)
+		assert.Equal(t, deleted, purgeBatchSize)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		app := newTestApplication(t)
+		snippets := &expiredSnippets{left: purgeBatchSize}
+		app.snippets = snippets
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		deleted, err := app.purgeExpired(ctx, time.Now())
+
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, 0)
+		assert.Equal(t, snippets.batches, 0)
+	})
+}
+
+func TestPurgeSessions(t *testing.T) {
+	app := newTestApplication(t)
+	sessions := &mocks.SessionModel{}
+	app.sessions = sessions
+
+	now := time.Now()
+	for i := 0; i < purgeBatchSize+1; i++ {
+		err := sessions.Insert(1, fmt.Sprintf("expired-%d", i), "192.0.2.1", "", now.Add(-time.Minute))
+		assert.NilError(t, err)
+	}
+	err := sessions.Insert(1, "current", "192.0.2.1", "", now.Add(time.Hour))
+	assert.NilError(t, err)
+
+	deleted, err := app.purgeSessions(context.Background(), now)
+
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, purgeBatchSize+1)
+
+	left, err := sessions.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(left), 1)
+	assert.Equal(t, left[0].Token, "current")
+}
+
+// a session model calling done once expired sessions have been deleted
+type expiredSessions struct {
+	*mocks.SessionModel
+	done func()
+}
+
+func (m *expiredSessions) DeleteExpired(before time.Time, limit int) (int, error) {
+	defer m.done()
+	return m.SessionModel.DeleteExpired(before, limit)
+}
+
+func TestPurge(t *testing.T) {
+	app := newTestApplication(t)
+
+	snippets := &expiredSnippets{left: 10}
+	app.snippets = snippets
+
+	// stop as soon as the first purge, which runs straight away, is done
+	ctx, cancel := context.WithCancel(context.Background())
+	sessions := &mocks.SessionModel{}
+	app.sessions = &expiredSessions{SessionModel: sessions, done: cancel}
+
+	err := sessions.Insert(1, "expired", "192.0.2.1", "", time.Now().Add(-time.Minute))
+	assert.NilError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		app.purge(ctx, time.Hour, 0)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purge did not stop when cancelled")
+	}
+
+	assert.Equal(t, snippets.left, 0)
+
+	left, err := sessions.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(left), 0)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// A budget is the rate at which a client may make requests, in requests per
+// minute, and how many it may make in a burst above that rate.
+type budget struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Rate limiters for the kinds of requests that get their own budget
+type rateLimits struct {
+	read  *rateLimiter
+	write *rateLimiter
+	auth  *rateLimiter
+}
+
+func newRateLimits(read, write, auth budget) *rateLimits {
+	return &rateLimits{
+		read:  newRateLimiter(read),
+		write: newRateLimiter(write),
+		auth:  newRateLimiter(auth),
+	}
+}
+
+// how long a client's bucket is kept after its last request
+const rateLimiterIdle = 10 * time.Minute
+
+// A rateLimiter keeps a token bucket for every client
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*rateClient
+	lastSweep time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(b budget) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(b.PerMinute / 60),
+		burst:   b.Burst,
+		clients: make(map[string]*rateClient),
+	}
+}
+
+// Takes a token from the client's bucket. If it is empty, returns false
+// and how long until the next token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// drop the buckets of clients that went away, a full bucket is no
+	// different from a new one
+	if now.Sub(l.lastSweep) > rateLimiterIdle {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &rateClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		// a zero burst never allows anything
+		return false, rateLimiterIdle
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// Pick the budget a request counts against. Signing up, logging in, unlocking
+// protected snippets and the like are the targets of password guessing and
+// spam. Every other request changing something, such as creating, editing or
+// deleting snippets through the site or the API, writes to the database and
+// counts against the write budget. Reading, and logging out, count as reading.
+func (l *rateLimits) limiterFor(r *http.Request) *rateLimiter {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return l.read
+	}
+
+	switch {
+	case r.URL.Path == "/user/logout":
+		return l.read
+	case strings.HasPrefix(r.URL.Path, "/user/"), strings.HasPrefix(r.URL.Path, "/snippet/unlock/"):
+		return l.auth
+	default:
+		return l.write
+	}
+}
+
+// Parse a comma separated list of IP addresses and CIDR ranges
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			entry += "/" + strconv.Itoa(bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+func (app *application) trustedProxy(ip net.IP) bool {
+	for _, network := range app.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IP address the request came from. When it was passed on by one
+// of our trusted proxies, the client is the last address in X-Forwarded-For
+// that isn't one of them. Anything before that could have been made up by
+// the client.
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !app.trustedProxy(ip) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if addr == nil {
+			// can't trust anything before a malformed entry
+			break
+		}
+
+		host = addr.String()
+		if !app.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return host
+}
+
+// Turn away clients that have used up their budget with 429 Too Many Requests
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.rateLimits == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, wait := app.rateLimits.limiterFor(r).allow(app.clientIP(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				app.writeJSON(w, http.StatusTooManyRequests, apiError{Error: "Rate limit exceeded"})
+			} else {
+				app.clientError(w, http.StatusTooManyRequests)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	assert.NilError(t, err)
+
+	app := &application{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{
+			name:       "Direct connection",
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted proxy",
+			remoteAddr: "203.0.113.7:51234",
+			forwarded:  "198.51.100.1",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "192.168.1.1:51234",
+			forwarded:  "198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Chain of trusted proxies",
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  "198.51.100.1, 10.0.0.5, 10.0.0.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed entries",
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  "1.2.3.4, 198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Malformed entry",
+			remoteAddr: "10.0.0.2:51234",
+			forwarded:  "198.51.100.1, nonsense, 10.0.0.1",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "Trusted proxy without header",
+			remoteAddr: "10.0.0.2:51234",
+			want:       "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			assert.Equal(t, app.clientIP(r), tt.want)
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	_, err := parseTrustedProxies("")
+	assert.NilError(t, err)
+
+	_, err = parseTrustedProxies("10.0.0.0/8,::1")
+	assert.NilError(t, err)
+
+	_, err = parseTrustedProxies("10.0.0.0/8,localhost")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimits = newRateLimits(
+		budget{PerMinute: 60, Burst: 3},
+		budget{PerMinute: 1, Burst: 2},
+		budget{PerMinute: 1, Burst: 1},
+	)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	create := func() (int, http.Header, string) {
+		return ts.do(t, http.MethodPost, "/api/v1/snippets", strings.NewReader(`{}`), nil)
+	}
+
+	// the first requests are let through, and turned away for lacking
+	// credentials
+	for i := 0; i < 2; i++ {
+		code, _, _ := create()
+		assert.Equal(t, code, http.StatusUnauthorized)
+	}
+
+	t.Run("Write budget used up", func(t *testing.T) {
+		code, header, body := create()
+
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, header.Get("Retry-After"), "60")
+		assert.StringContains(t, body, `{"error":"Rate limit exceeded"}`)
+	})
+
+	t.Run("Updates and deletes share the write budget", func(t *testing.T) {
+		code, _, _ := ts.do(t, http.MethodPut, "/api/v1/snippets/Xq3vR8tLm2Pk", strings.NewReader(`{}`), nil)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+
+		code, _, _ = ts.do(t, http.MethodDelete, "/api/v1/snippets/Xq3vR8tLm2Pk", nil, nil)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+
+		code, _, _ = ts.postForm(t, "/snippet/delete/Xq3vR8tLm2Pk", nil)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Reading is a separate budget", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippets")
+		assert.Equal(t, code, http.StatusOK)
+	})
+
+	t.Run("Auth budget", func(t *testing.T) {
+		code, _, _ := ts.postForm(t, "/user/login", nil)
+		assert.Equal(t, code, http.StatusBadRequest)
+
+		code, header, _ := ts.postForm(t, "/user/login", nil)
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, header.Get("Retry-After"), "60")
+	})
+}
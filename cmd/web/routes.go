@@ -29,25 +29,77 @@ func (app *application) routes() http.Handler {
 
 	// route for other handlers
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
+	router.Handler(http.MethodGet, "/search", dynamic.ThenFunc(app.search))
+	router.Handler(http.MethodGet, "/tag/:name", dynamic.ThenFunc(app.tagView))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/snippet/download/:id", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodPost, "/snippet/unlock/:id", dynamic.ThenFunc(app.snippetUnlockPost))
+	router.Handler(http.MethodPost, "/snippet/reveal/:id", dynamic.ThenFunc(app.snippetRevealPost))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.userPasswordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.userPasswordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset/:token", dynamic.ThenFunc(app.userPasswordReset))
+	router.Handler(http.MethodPost, "/user/password/reset/:token", dynamic.ThenFunc(app.userPasswordResetPost))
+	router.Handler(http.MethodGet, "/user/verify/:token", dynamic.ThenFunc(app.userVerify))
 	router.Handler(http.MethodGet, "/ping", http.HandlerFunc(ping))
 	router.Handler(http.MethodGet, "/about", dynamic.ThenFunc(app.about))
 
 	// Chain for user-protected routes
 	protected := dynamic.Append(app.requireAuthentication)
 
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	// and for routes that may also need a confirmed email address
+	verified := protected.Append(app.requireVerification)
+
+	router.Handler(http.MethodGet, "/snippet/create", verified.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippet/create", verified.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", verified.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", verified.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodGet, "/snippet/extend/:id", verified.ThenFunc(app.snippetExtend))
+	router.Handler(http.MethodPost, "/snippet/extend/:id", verified.ThenFunc(app.snippetExtendPost))
+	router.Handler(http.MethodPost, "/snippet/restore/:id/:revision", verified.ThenFunc(app.snippetRestorePost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", verified.ThenFunc(app.snippetDeletePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodPost, "/user/verify/resend", protected.ThenFunc(app.userVerifyResendPost))
 	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
+	router.Handler(http.MethodGet, "/account/snippets", protected.ThenFunc(app.accountSnippets))
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.accountTokensPost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke/:id", protected.ThenFunc(app.accountTokenRevokePost))
+	router.Handler(http.MethodGet, "/account/profile", protected.ThenFunc(app.accountProfile))
+	router.Handler(http.MethodPost, "/account/profile", protected.ThenFunc(app.accountProfilePost))
+	router.Handler(http.MethodGet, "/account/export", protected.ThenFunc(app.accountExport))
+	router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete", protected.ThenFunc(app.accountDeletePost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.accountSessions))
+	router.Handler(http.MethodPost, "/account/sessions/revoke/:id", protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	router.Handler(http.MethodGet, "/account/2fa", protected.ThenFunc(app.accountTwoFactor))
+	router.Handler(http.MethodGet, "/account/2fa/qr", protected.ThenFunc(app.accountTwoFactorQR))
+	router.Handler(http.MethodPost, "/account/2fa/enable", protected.ThenFunc(app.accountTwoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable", protected.ThenFunc(app.accountTwoFactorDisablePost))
 	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
 	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
 
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// The JSON API sits outside the session and CSRF middleware, clients
+	// authenticate every request on their own instead
+	api := alice.New(app.authenticateAPI, app.authenticateToken)
+	apiProtected := api.Append(app.requireAPIAuthentication, app.requireWriteScope, app.requireAPIVerification)
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetDelete))
+
+	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders, app.rateLimit)
 
 	return standard.Then(router)
 }
@@ -4,22 +4,49 @@ import (
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"snippetbox.opre.net/internal/diff"
 	"snippetbox.opre.net/internal/models"
+	"snippetbox.opre.net/internal/syntax"
 	"snippetbox.opre.net/ui"
 )
 
 // Holding structure for data to be passed into an HTML template
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
-	User            *models.User
+	CurrentYear         int
+	Snippet             *models.Snippet
+	Snippets            []*models.Snippet
+	Form                any
+	Flash               string
+	IsAuthenticated     bool
+	AuthenticatedUserID int
+	CSRFToken           string
+	User                *models.User
+	Pagination          *pagination
+	Query               string
+	Tag                 string
+	Tokens              []*models.Token
+	NewToken            string
+	ResetToken          string
+	TwoFactorEnabled    bool
+	TOTPSecret          string
+	RecoveryCodes       []string
+	Sessions            []*models.Session
+	CurrentSessionID    int
+	KeepSnippets        bool
+	Revisions           []*models.Revision
+	Diff                *revisionDiff
+}
+
+// Two revisions of a snippet and the changes between them
+type revisionDiff struct {
+	From  *models.Revision
+	To    *models.Revision
+	Hunks []diff.Hunk
 }
 
 // formats time into a human friendly way, a method within the template.
@@ -33,9 +60,85 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// builds a case-insensitive pattern matching any word of a search query, or
+// returns nil if the query has no usable words
+func searchPattern(query string) *regexp.Regexp {
+	terms := []string{}
+	for _, term := range strings.Fields(query) {
+		// drop the characters MySQL treats as boolean search operators
+		term = strings.Trim(term, `+-<>()~*"`)
+		if term != "" {
+			terms = append(terms, regexp.QuoteMeta(term))
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// escapes text for HTML output and wraps every word of the query found in it
+// in a <mark> element
+func highlight(text, query string) template.HTML {
+	rx := searchPattern(query)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// cuts a window of at most 200 characters out of text, starting shortly
+// before the first word of the query found in it
+func excerpt(text, query string) string {
+	const (
+		length = 200
+		before = 60
+	)
+
+	runes := []rune(text)
+
+	start := 0
+	if rx := searchPattern(query); rx != nil {
+		if loc := rx.FindStringIndex(text); loc != nil {
+			start = max(0, utf8.RuneCountInString(text[:loc[0]])-before)
+		}
+	}
+	end := min(len(runes), start+length)
+
+	result := string(runes[start:end])
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(runes) {
+		result = result + "…"
+	}
+
+	return result
+}
+
 // create global function map for the template
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"highlight": highlight,
+	"excerpt":   excerpt,
+	// syntax highlighting for the snippet view and its language picker
+	"highlightCode": syntax.Render,
+	"languageName":  syntax.Name,
+	"languages":     func() []string { return syntax.Languages },
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
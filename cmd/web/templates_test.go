@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -40,3 +41,91 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Single match",
+			text:  "An old silent pond",
+			query: "pond",
+			want:  "An old silent <mark>pond</mark>",
+		},
+		{
+			name:  "Case insensitive",
+			text:  "An old silent Pond",
+			query: "POND",
+			want:  "An old silent <mark>Pond</mark>",
+		},
+		{
+			name:  "Several words",
+			text:  "An old silent pond",
+			query: "old pond",
+			want:  "An <mark>old</mark> silent <mark>pond</mark>",
+		},
+		{
+			name:  "Escapes HTML",
+			text:  "<b>pond</b>",
+			query: "pond",
+			want:  "&lt;b&gt;<mark>pond</mark>&lt;/b&gt;",
+		},
+		{
+			name:  "Boolean operators",
+			text:  "An old silent pond",
+			query: "+pond*",
+			want:  "An old silent <mark>pond</mark>",
+		},
+		{
+			name:  "Empty query",
+			text:  "An old silent pond",
+			query: "",
+			want:  "An old silent pond",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(highlight(tt.text, tt.query)), tt.want)
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	long := strings.Repeat("a", 100) + " pond " + strings.Repeat("b", 300)
+
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Short text",
+			text:  "An old silent pond",
+			query: "pond",
+			want:  "An old silent pond",
+		},
+		{
+			name:  "Starts before the match",
+			text:  long,
+			query: "pond",
+			want:  "…" + strings.Repeat("a", 59) + " pond " + strings.Repeat("b", 135) + "…",
+		},
+		{
+			name:  "No match",
+			text:  long,
+			query: "frog",
+			want:  strings.Repeat("a", 100) + " pond " + strings.Repeat("b", 94) + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, excerpt(tt.text, tt.query), tt.want)
+		})
+	}
+}
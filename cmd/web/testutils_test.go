@@ -15,6 +15,8 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"snippetbox.opre.net/internal/lockout"
+	"snippetbox.opre.net/internal/mailer"
 	"snippetbox.opre.net/internal/models/mocks"
 )
 
@@ -33,14 +35,28 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	// Lockouts are kept in memory, just like in production.
+	lockoutStore := lockout.NewMemory(time.Hour)
+
 	return &application{
 		errLog:         log.New(io.Discard, "", 0),
 		infoLog:        log.New(io.Discard, "", 0),
 		snippets:       &mocks.SnippetModel{}, // Use the mock.
 		users:          &mocks.UserModel{},    // Use the mock.
+		tokens:         &mocks.TokenModel{},   // Use the mock.
+		resets:         &mocks.PasswordResetModel{},
+		twoFactor:      &mocks.TwoFactorModel{},
+		sessions:       &mocks.SessionModel{},
+		loginAccounts:  lockout.New(lockoutStore, accountLockout),
+		loginIPs:       lockout.New(lockoutStore, ipLockout),
+		mailer:         &mailer.Log{Logger: log.New(io.Discard, "", 0)},
+		baseURL:        "https://snippetbox.test",
+		secretKey:      []byte("test secret"),
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+
+		deletedSnippets: deletedSnippetsDelete,
 	}
 }
 
@@ -128,3 +144,50 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body.
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Log in as the mocked user alice@example.com and return a CSRF token that
+// can be used for subsequent POST requests in the same session.
+func (ts *testServer) login(t *testing.T) string {
+	return ts.loginAs(t, "alice@example.com")
+}
+
+// Log in as any of the mocked users, they all share the same password.
+func (ts *testServer) loginAs(t *testing.T, email string) string {
+	_, _, body := ts.get(t, "/user/login")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", validCSRFToken)
+	ts.postForm(t, "/user/login", form)
+
+	return validCSRFToken
+}
+
+// Send an arbitrary request to the test server, for methods and headers the
+// get() and postForm() helpers don't cover. The urlPath is relative to the
+// server, e.g. "/api/v1/snippets".
+func (ts *testServer) do(t *testing.T, method, urlPath string, body io.Reader, header http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(respBody)
+}
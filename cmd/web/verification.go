@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long an emailed verification link stays valid
+const verificationTTL = 48 * time.Hour
+
+var errInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// Verification links carry the user ID, the address being confirmed and an
+// expiry time, signed with the server's secret key. Nothing is stored, a link
+// is valid for as long as its signature checks out and it hasn't expired.
+func (app *application) verificationToken(userID int, email string, expires time.Time) string {
+	payload := fmt.Sprintf("%d|%d|%s", userID, expires.Unix(), email)
+
+	mac := hmac.New(sha256.New, app.secretKey)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// check the signature and expiry of a verification token and return the user
+// ID and email address it was issued for
+func (app *application) parseVerificationToken(token string) (int, string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	mac := hmac.New(sha256.New, app.secretKey)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	fields := strings.SplitN(string(payload), "|", 3)
+	if len(fields) != 3 {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	userID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, "", errInvalidVerificationToken
+	}
+
+	return userID, fields[2], nil
+}
+
+// email the user a link to confirm their address
+func (app *application) sendVerificationEmail(userID int, name, email string) error {
+	token := app.verificationToken(userID, email, time.Now().Add(verificationTTL))
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Please confirm the email address of your Snippetbox account by following "+
+		"this link within the next 48 hours:\n\n"+
+		"%s/user/verify/%s\n\n"+
+		"If you didn't sign up for Snippetbox, you can safely ignore this email.\n",
+		name, app.baseURL, token)
+
+	return app.mailer.Send(email, "Confirm your Snippetbox email address", body)
+}
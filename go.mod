@@ -18,3 +18,14 @@ require (
 require golang.org/x/crypto v0.16.0
 
 require github.com/justinas/nosurf v1.1.1
+
+require github.com/alecthomas/chroma/v2 v2.12.0
+
+require github.com/pquerna/otp v1.5.0
+
+require golang.org/x/time v0.5.0
+
+require (
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+)
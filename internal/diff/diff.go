@@ -0,0 +1,206 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind says whether a line is shared by both texts, or only in the old or the
+// new one. The values double as the line prefixes of a unified diff.
+type Kind string
+
+const (
+	Equal  Kind = " "
+	Insert Kind = "+"
+	Delete Kind = "-"
+)
+
+// Line is a single line of a diff, without its trailing newline.
+type Line struct {
+	Kind Kind
+	Text string
+}
+
+func (l Line) String() string {
+	return string(l.Kind) + l.Text
+}
+
+// Hunk is a run of changed lines along with the unchanged lines around them.
+// Line numbers start at 1, as in the output of diff -u.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Header returns the hunk's range line, such as "@@ -1,4 +1,5 @@".
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Above this many cells the table used to find the longest common subsequence
+// would take too much memory, so the changed lines are reported as removed and
+// added wholesale instead.
+const maxCells = 1 << 20
+
+// Lines compares two texts line by line and returns every line of both, in
+// order, marked as kept, removed or added. Windows line endings are treated
+// the same as Unix ones, since browsers submit textareas with them.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+
+	// lines shared at the start and end don't need to go through the table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(x)+len(y)-prefix-suffix)
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+	lines = append(lines, compare(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+
+	return lines
+}
+
+// Unified compares two texts and returns the hunks of a unified diff between
+// them, each with up to context unchanged lines either side of its changes.
+// Identical texts give no hunks.
+func Unified(a, b string, context int) []Hunk {
+	lines := Lines(a, b)
+
+	// the line number each line has, or would have, in the old and new text
+	oldNumbers := make([]int, len(lines))
+	newNumbers := make([]int, len(lines))
+	oldLine, newLine := 1, 1
+	for i, line := range lines {
+		oldNumbers[i], newNumbers[i] = oldLine, newLine
+		if line.Kind != Insert {
+			oldLine++
+		}
+		if line.Kind != Delete {
+			newLine++
+		}
+	}
+
+	var hunks []Hunk
+	for i := 0; i < len(lines); i++ {
+		if lines[i].Kind == Equal {
+			continue
+		}
+
+		// extend the hunk until there is more than twice the context of
+		// unchanged lines before the next change
+		start, end := max(i-context, 0), i
+		for j := i + 1; j < len(lines) && j <= end+2*context+1; j++ {
+			if lines[j].Kind != Equal {
+				end = j
+			}
+		}
+		end = min(end+context, len(lines)-1)
+
+		hunk := Hunk{
+			OldStart: oldNumbers[start],
+			NewStart: newNumbers[start],
+			Lines:    lines[start : end+1],
+		}
+		for _, line := range hunk.Lines {
+			if line.Kind != Insert {
+				hunk.OldLines++
+			}
+			if line.Kind != Delete {
+				hunk.NewLines++
+			}
+		}
+		// an empty range refers to the line before it, as diff -u does
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+
+		hunks = append(hunks, hunk)
+		i = end
+	}
+
+	return hunks
+}
+
+// Split text into lines, ignoring the newline at the end of the last one.
+func split(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Diff two runs of lines using the longest common subsequence between them.
+// Within a change, removed lines come before added ones.
+func compare(x, y []string) []Line {
+	lines := make([]Line, 0, len(x)+len(y))
+
+	if len(x)*len(y) > maxCells {
+		for _, text := range x {
+			lines = append(lines, Line{Delete, text})
+		}
+		for _, text := range y {
+			lines = append(lines, Line{Insert, text})
+		}
+		return lines
+	}
+
+	// common[i*width+j] is the length of the longest common subsequence of
+	// x[i:] and y[j:]
+	width := len(y) + 1
+	common := make([]int, (len(x)+1)*width)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				common[i*width+j] = common[(i+1)*width+j+1] + 1
+			} else {
+				common[i*width+j] = max(common[(i+1)*width+j], common[i*width+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case common[(i+1)*width+j] >= common[i*width+j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+
+	return lines
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+// render hunks the way diff -u prints them, without the file headers
+func render(hunks []Hunk) string {
+	var b strings.Builder
+	for _, hunk := range hunks {
+		b.WriteString(hunk.Header() + "\n")
+		for _, line := range hunk.Lines {
+			b.WriteString(line.String() + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines("a\nb\nc\n", "a\nx\nc\nd\n")
+
+	want := []Line{
+		{Equal, "a"},
+		{Delete, "b"},
+		{Insert, "x"},
+		{Equal, "c"},
+		{Insert, "d"},
+	}
+
+	assert.Equal(t, len(lines), len(want))
+	for i := range want {
+		assert.Equal(t, lines[i], want[i])
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		context int
+		want    string
+	}{
+		{
+			name:    "Identical",
+			a:       "a\nb\n",
+			b:       "a\nb\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Windows line endings",
+			a:       "a\r\nb\r\n",
+			b:       "a\nb\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Changed line",
+			a:       "a\nb\nc\n",
+			b:       "a\nB\nc\n",
+			context: 3,
+			want:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "From empty",
+			a:       "",
+			b:       "a\nb\n",
+			context: 3,
+			want:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "To empty",
+			a:       "a\n",
+			b:       "",
+			context: 3,
+			want:    "@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "Separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:       "0\n2\n3\n4\n5\n6\n7\n8\n10\n",
+			context: 1,
+			want:    "@@ -1,2 +1,2 @@\n-1\n+0\n 2\n@@ -8,2 +8,2 @@\n 8\n-9\n+10\n",
+		},
+		{
+			name:    "Merged hunks",
+			a:       "1\n2\n3\n4\n",
+			b:       "0\n2\n3\n5\n",
+			context: 1,
+			want:    "@@ -1,4 +1,4 @@\n-1\n+0\n 2\n 3\n-4\n+5\n",
+		},
+		{
+			name:    "Inserted in the middle",
+			a:       "1\n2\n3\n4\n5\n6\n",
+			b:       "1\n2\n3\nx\n4\n5\n6\n",
+			context: 2,
+			want:    "@@ -2,4 +2,5 @@\n 2\n 3\n+x\n 4\n 5\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, render(Unified(tt.a, tt.b, tt.context)), tt.want)
+		})
+	}
+}
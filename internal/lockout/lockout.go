@@ -0,0 +1,151 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is the failure count kept for a key, such as an email address or an
+// IP address, and when the latest failure happened.
+type Entry struct {
+	Failures int
+	Last     time.Time
+}
+
+// Store keeps the failure counters. Memory is the only implementation so far,
+// one backed by a shared database or cache would let several servers agree.
+type Store interface {
+	Get(key string) (Entry, error)
+	Fail(key string) (Entry, error)
+	Reset(key string) error
+}
+
+// Policy decides how long a key is locked for after repeated failures. The
+// first Threshold failures are free, after that every failure doubles the
+// wait, starting at BaseDelay and never going above MaxDelay.
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns how long to wait after the given number of failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+// Limiter applies a Policy to the counters in a Store.
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Wait returns how much longer the key is locked for, or 0 if it isn't.
+func (l *Limiter) Wait(key string) (time.Duration, error) {
+	entry, err := l.store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	unlock := entry.Last.Add(l.policy.Delay(entry.Failures))
+	return max(unlock.Sub(l.now()), 0), nil
+}
+
+// Fail records a failed attempt for the key.
+func (l *Limiter) Fail(key string) error {
+	_, err := l.store.Fail(key)
+	return err
+}
+
+// Reset forgets the failures of the key, unlocking it straight away.
+func (l *Limiter) Reset(key string) error {
+	return l.store.Reset(key)
+}
+
+// Memory is a Store that keeps the counters in memory. A key's counter is
+// forgotten once it has seen no failures for the TTL.
+type Memory struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]Entry
+	lastSweep time.Time
+}
+
+func NewMemory(ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]Entry),
+	}
+}
+
+func (m *Memory) Get(key string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || m.stale(entry) {
+		return Entry{}, nil
+	}
+	return entry, nil
+}
+
+func (m *Memory) Fail(key string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	// every so often drop the stale counters, so keys that are never seen
+	// again don't pile up
+	if now.Sub(m.lastSweep) > m.ttl {
+		for k, e := range m.entries {
+			if m.stale(e) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	entry := m.entries[key]
+	if m.stale(entry) {
+		entry = Entry{}
+	}
+
+	entry.Failures++
+	entry.Last = now
+	m.entries[key] = entry
+
+	return entry, nil
+}
+
+func (m *Memory) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) stale(entry Entry) bool {
+	return m.now().Sub(entry.Last) > m.ttl
+}
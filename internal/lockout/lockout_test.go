@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Minute},
+		{failures: 5, want: 2 * time.Minute},
+		{failures: 7, want: 8 * time.Minute},
+		{failures: 8, want: 10 * time.Minute},
+		{failures: 100, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, policy.Delay(tt.failures), tt.want)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	store := NewMemory(time.Hour)
+	store.now = clock
+
+	limiter := New(store, Policy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	limiter.now = clock
+
+	wait := func() time.Duration {
+		d, err := limiter.Wait("alice@example.com")
+		assert.NilError(t, err)
+		return d
+	}
+
+	t.Run("Free attempts", func(t *testing.T) {
+		limiter.Fail("alice@example.com")
+		limiter.Fail("alice@example.com")
+		assert.Equal(t, wait(), time.Duration(0))
+	})
+
+	t.Run("Locked after the threshold", func(t *testing.T) {
+		limiter.Fail("alice@example.com")
+		assert.Equal(t, wait(), time.Minute)
+
+		now = now.Add(45 * time.Second)
+		assert.Equal(t, wait(), 15*time.Second)
+	})
+
+	t.Run("Unlocked with time", func(t *testing.T) {
+		now = now.Add(15 * time.Second)
+		assert.Equal(t, wait(), time.Duration(0))
+
+		// but the next failure locks it for twice as long
+		limiter.Fail("alice@example.com")
+		assert.Equal(t, wait(), 2*time.Minute)
+	})
+
+	t.Run("Other keys unaffected", func(t *testing.T) {
+		d, err := limiter.Wait("bob@example.com")
+		assert.NilError(t, err)
+		assert.Equal(t, d, time.Duration(0))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		limiter.Reset("alice@example.com")
+		assert.Equal(t, wait(), time.Duration(0))
+	})
+
+	t.Run("Forgotten after the TTL", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			limiter.Fail("alice@example.com")
+		}
+		now = now.Add(2 * time.Hour)
+		assert.Equal(t, wait(), time.Duration(0))
+
+		entry, err := store.Fail("alice@example.com")
+		assert.NilError(t, err)
+		assert.Equal(t, entry.Failures, 1)
+	})
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Mailer sends plain text emails. The SMTP implementation is used in
+// production, Log stands in for it during local development and tests.
+type Mailer interface {
+	Send(recipient, subject, body string) error
+}
+
+// SMTP delivers email through an SMTP server, authenticating with PLAIN auth
+// when a username is set. The sender may include a display name, such as
+// "Snippetbox <no-reply@example.com>", which only shows up in the From header.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+func (m *SMTP) Send(recipient, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// the envelope takes the bare address, servers reject a display name there
+	sender, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.Sender, err)
+	}
+
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	return smtp.SendMail(address, auth, sender.Address, []string{recipient}, message(m.Sender, recipient, subject, body))
+}
+
+// Log writes every email to a logger instead of sending it, so the links in
+// them can be followed without an SMTP server
+type Log struct {
+	Logger *log.Logger
+}
+
+func (m *Log) Send(recipient, subject, body string) error {
+	m.Logger.Printf("email to %s\n%s", recipient, message("snippetbox", recipient, subject, body))
+	return nil
+}
+
+// build an RFC 5322 message with a UTF-8 plain text body
+func message(sender, recipient, subject, body string) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", sender)
+	fmt.Fprintf(&b, "To: %s\r\n", recipient)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+
+	return b.Bytes()
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	m := &Log{Logger: log.New(buf, "", 0)}
+
+	err := m.Send("alice@example.com", "Héllo", "An old silent pond...")
+
+	assert.NilError(t, err)
+	assert.StringContains(t, buf.String(), "To: alice@example.com\r\n")
+	// non-ASCII subjects are encoded
+	assert.StringContains(t, buf.String(), "Subject: =?utf-8?q?H=C3=A9llo?=\r\n")
+	assert.StringContains(t, buf.String(), "\r\n\r\nAn old silent pond...")
+}
+
+// a bare bones SMTP server accepting a single message, which records the
+// commands and message lines it was sent
+func fakeSMTPServer(t *testing.T) (host string, port int, commands <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var lines []string
+
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+
+			switch strings.ToUpper(strings.Fields(line + " ")[0]) {
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, _ := text.ReadDotLines()
+				lines = append(lines, data...)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				received <- lines
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+		received <- lines
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestSMTP(t *testing.T) {
+	host, port, commands := fakeSMTPServer(t)
+
+	m := &SMTP{Host: host, Port: port, Sender: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send("alice@example.com", "Hello", "An old silent pond...")
+	assert.NilError(t, err)
+
+	lines := <-commands
+	// only the bare address goes in the envelope
+	assert.StringContains(t, strings.Join(lines, "\n"), "MAIL FROM:<no-reply@example.com>")
+	assert.StringContains(t, strings.Join(lines, "\n"), "RCPT TO:<alice@example.com>")
+	// while the From header keeps the display name
+	assert.StringContains(t, strings.Join(lines, "\n"), "From: Snippetbox <no-reply@example.com>")
+}
+
+func TestSMTPInvalidSender(t *testing.T) {
+	m := &SMTP{Host: "127.0.0.1", Port: 25, Sender: "no-reply at example.com"}
+
+	err := m.Send("alice@example.com", "Hello", "An old silent pond...")
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"time"
+
+	"snippetbox.opre.net/internal/models"
+)
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	return "RESETTOKEN", nil
+}
+
+func (m *PasswordResetModel) Exists(plaintext string) (bool, error) {
+	return plaintext == "RESETTOKEN", nil
+}
+
+func (m *PasswordResetModel) Consume(plaintext string) (int, error) {
+	if plaintext == "RESETTOKEN" {
+		return 1, nil
+	}
+	return 0, models.ErrNoRecord
+}
@@ -0,0 +1,130 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.opre.net/internal/models"
+)
+
+// SessionModel keeps sessions in memory, so tests can log in from several
+// clients and revoke one from another. The zero value is ready to use.
+type SessionModel struct {
+	mu       sync.Mutex
+	sessions []*models.Session
+	nextID   int
+}
+
+func (m *SessionModel) Insert(userID int, token, ip, userAgent string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	m.sessions = append(m.sessions, &models.Session{
+		ID:        m.nextID,
+		UserID:    userID,
+		Token:     token,
+		IP:        ip,
+		UserAgent: userAgent,
+		Created:   time.Now(),
+		LastSeen:  time.Now(),
+		Expires:   expires,
+	})
+
+	return nil
+}
+
+func (m *SessionModel) Touch(token, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.Token == token {
+			s.LastSeen = time.Now()
+			s.IP = ip
+		}
+	}
+
+	return nil
+}
+
+func (m *SessionModel) ForUser(userID int) ([]*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []*models.Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			copied := *s
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (m *SessionModel) Delete(id, userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s.ID == id && s.UserID == userID {
+			m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+			return s.Token, nil
+		}
+	}
+
+	return "", models.ErrNoRecord
+}
+
+func (m *SessionModel) DeleteOthers(userID int, token string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := []string{}
+	kept := m.sessions[:0]
+
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Token != token {
+			tokens = append(tokens, s.Token)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	m.sessions = kept
+
+	return tokens, nil
+}
+
+func (m *SessionModel) DeleteToken(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s.Token == token {
+			m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *SessionModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	kept := m.sessions[:0]
+
+	for _, s := range m.sessions {
+		if deleted < limit && s.Expires.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	m.sessions = kept
+
+	return deleted, nil
+}
@@ -1,34 +1,328 @@
 package mocks
 
 import (
+	"strings"
 	"time"
 
 	"snippetbox.opre.net/internal/models"
 )
 
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	Slug:       "Xq3vR8tLm2Pk",
+	UserID:     1,
+	Author:     "Alice",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Tags:       []string{"haiku"},
 }
 
+// a snippet owned by somebody other than the mocked logged in user
+var mockOtherSnippet = &models.Snippet{
+	ID:         3,
+	Slug:       "Wn7bT4yHc9Js",
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "Over the wintry",
+	Content:    "Over the wintry forest...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+}
+
+// a private snippet only Bob may see
+var mockPrivateSnippet = &models.Snippet{
+	ID:         4,
+	Slug:       "Pr5dK2wQz8Lf",
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "Winter seclusion",
+	Content:    "Winter seclusion...",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+}
+
+// an unlisted snippet, reachable by its link but never listed, which never
+// expires
+var mockUnlistedSnippet = &models.Snippet{
+	ID:         5,
+	Slug:       "Cs6gM3xVn1Bh",
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "A cicada shell",
+	Content:    "A cicada shell...",
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+}
+
+// a public snippet protected by SnippetPassword
+var mockProtectedSnippet = &models.Snippet{
+	ID:         6,
+	Slug:       "Lm8pQ2rT5vWy",
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "Lightning flash",
+	Content:    "Lightning flash...",
+	Visibility: models.VisibilityPublic,
+	Protected:  true,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+}
+
+// a snippet deleted after its first view
+var mockBurnSnippet = &models.Snippet{
+	ID:         7,
+	Slug:       "Bn2cV5xZq8Tr",
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "The first cold shower",
+	Content:    "The first cold shower...",
+	Visibility: models.VisibilityUnlisted,
+	ViewsLeft:  1,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+}
+
+// a snippet of the mocked logged in user that has expired but hasn't been
+// purged yet
+var mockExpiredSnippet = &models.Snippet{
+	ID:         8,
+	Slug:       "Ex4pR7dWq2Ns",
+	UserID:     1,
+	Author:     "Alice",
+	Title:      "Autumn moonlight",
+	Content:    "Autumn moonlight...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now().Add(-48 * time.Hour),
+	Expires:    time.Now().Add(-24 * time.Hour),
+}
+
+// the password unlocking mockProtectedSnippet
+const SnippetPassword = "open sesame"
+
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+func (m *SnippetModel) Insert(userID int, title string, content string, language string, visibility string, password string, expires time.Time, views int) (int, string, error) {
+	return 2, "Nk4hF7sJd2Qa", nil
 }
 
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockOtherSnippet, nil
+	case 4:
+		return mockPrivateSnippet, nil
+	case 5:
+		return mockUnlistedSnippet, nil
+	case 6:
+		return mockProtectedSnippet, nil
+	case 7:
+		return mockBurnSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
+func (m *SnippetModel) GetIncludingExpired(id int) (*models.Snippet, error) {
+	if id == mockExpiredSnippet.ID {
+		return mockExpiredSnippet, nil
+	}
+	return m.Get(id)
+}
+
+func (m *SnippetModel) GetBySlug(slug string) (*models.Snippet, error) {
+	for _, snippet := range []*models.Snippet{mockSnippet, mockOtherSnippet, mockPrivateSnippet, mockUnlistedSnippet, mockProtectedSnippet, mockBurnSnippet} {
+		if snippet.Slug == slug {
+			return snippet, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *SnippetModel) Unlock(id int, password string) error {
+	switch {
+	case id == 6 && password == SnippetPassword:
+		return nil
+	case id >= 1 && id <= 7 && id != 2:
+		return models.ErrInvalidCredentials
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) View(id int) (*models.Snippet, error) {
+	snippet, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	viewed := *snippet
+	if viewed.ViewsLeft > 0 {
+		viewed.ViewsLeft--
+	}
+	return &viewed, nil
+}
+
+func (m *SnippetModel) Extend(id int, expires time.Time) error {
+	return nil
+}
+
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) List(limit int, offset int) ([]*models.Snippet, error) {
+	if offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) Count() (int, error) {
+	return 1, nil
+}
+
+func (m *SnippetModel) Search(query string, limit int, offset int) ([]*models.Snippet, error) {
+	if strings.Contains(strings.ToLower(mockSnippet.Content), strings.ToLower(query)) && offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) CountSearch(query string) (int, error) {
+	if strings.Contains(strings.ToLower(mockSnippet.Content), strings.ToLower(query)) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *SnippetModel) Update(id int, title string, content string, language string, visibility string) error {
+	return nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	return nil
+}
+
+func (m *SnippetModel) Owner(id int) (int, error) {
+	switch id {
+	case 1:
+		return mockSnippet.UserID, nil
+	case 3:
+		return mockOtherSnippet.UserID, nil
+	case 4:
+		return mockPrivateSnippet.UserID, nil
+	case 5:
+		return mockUnlistedSnippet.UserID, nil
+	case 6:
+		return mockProtectedSnippet.UserID, nil
+	case 7:
+		return mockBurnSnippet.UserID, nil
+	case 8:
+		return mockExpiredSnippet.UserID, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) OwnerBySlug(slug string) (int, int, error) {
+	if slug == mockExpiredSnippet.Slug {
+		return mockExpiredSnippet.ID, mockExpiredSnippet.UserID, nil
+	}
+
+	snippet, err := m.GetBySlug(slug)
+	if err != nil {
+		return 0, 0, err
+	}
+	return snippet.ID, snippet.UserID, nil
+}
+
+func (m *SnippetModel) ByUser(userID int, limit int, offset int) ([]*models.Snippet, error) {
+	if userID == 1 && offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) CountByUser(userID int) (int, error) {
+	if userID == 1 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	return nil
+}
+
+func (m *SnippetModel) ByTag(tag string, limit int, offset int) ([]*models.Snippet, error) {
+	if tag == "haiku" && offset == 0 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) CountByTag(tag string) (int, error) {
+	if tag == "haiku" {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// the history of mockSnippet, whose first draft had another title and last line
+var mockRevisions = []*models.Revision{
+	{
+		Number:  2,
+		UserID:  1,
+		Author:  "Alice",
+		Title:   "An old silent pond",
+		Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+		Created: time.Now(),
+	},
+	{
+		Number:  1,
+		UserID:  1,
+		Author:  "Alice",
+		Title:   "An old pond",
+		Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence.",
+		Created: time.Now().Add(-time.Hour),
+	},
+}
+
+func (m *SnippetModel) Revisions(id int) ([]*models.Revision, error) {
+	if id == 1 {
+		return mockRevisions, nil
+	}
+
+	// every other snippet has never been edited
+	snippet, err := m.Get(id)
+	if err != nil {
+		return []*models.Revision{}, nil
+	}
+	return []*models.Revision{{
+		Number:   1,
+		UserID:   snippet.UserID,
+		Author:   snippet.Author,
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.Language,
+		Created:  snippet.Created,
+	}}, nil
+}
+
+func (m *SnippetModel) Restore(id int, revision int) error {
+	if id == 1 && revision >= 1 && revision <= len(mockRevisions) {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"time"
+
+	"snippetbox.opre.net/internal/models"
+)
+
+var mockTokens = map[string]*models.Token{
+	"sb_READTOKEN": {
+		ID:      1,
+		UserID:  1,
+		Name:    "Dashboard",
+		Scope:   models.ScopeRead,
+		Created: time.Now(),
+	},
+	"sb_WRITETOKEN": {
+		ID:      2,
+		UserID:  1,
+		Name:    "CI",
+		Scope:   models.ScopeReadWrite,
+		Created: time.Now(),
+	},
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	return "sb_NEWTOKEN", nil
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (*models.Token, error) {
+	token, ok := mockTokens[plaintext]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return token, nil
+}
+
+func (m *TokenModel) ForUser(userID int) ([]*models.Token, error) {
+	if userID != 1 {
+		return []*models.Token{}, nil
+	}
+	return []*models.Token{mockTokens["sb_WRITETOKEN"], mockTokens["sb_READTOKEN"]}, nil
+}
+
+func (m *TokenModel) Delete(id, userID int) error {
+	if userID == 1 && (id == 1 || id == 2) {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,65 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.opre.net/internal/models"
+)
+
+// TOTPSecret is the secret of the mocked user carol@example.com, the only one
+// with two-factor authentication enabled. RecoveryCode is her one recovery
+// code.
+const (
+	TOTPSecret   = "JBSWY3DPEHPK3PXP"
+	RecoveryCode = "abcde-12345"
+)
+
+// TwoFactorModel remembers the latest time step used by carol, so replayed
+// codes can be tested. The zero value is ready to use.
+type TwoFactorModel struct {
+	mu       sync.Mutex
+	lastStep int64
+}
+
+func (m *TwoFactorModel) Get(userID int) (*models.TwoFactor, error) {
+	if userID != 3 {
+		return nil, models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &models.TwoFactor{
+		UserID:   3,
+		Secret:   TOTPSecret,
+		LastStep: m.lastStep,
+		Created:  time.Now(),
+	}, nil
+}
+
+func (m *TwoFactorModel) Enable(userID int, secret string, step int64) ([]string, error) {
+	return []string{"aaaaa-bbbbb", "ccccc-ddddd"}, nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID != 3 || step <= m.lastStep {
+		return models.ErrInvalidCredentials
+	}
+	m.lastStep = step
+	return nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	if userID == 3 && code == RecoveryCode {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
@@ -6,47 +6,66 @@ import (
 	"snippetbox.opre.net/internal/models"
 )
 
+// Alice has confirmed her email address, Bob hasn't yet. Carol has also
+// turned on two-factor authentication. All of them use the password
+// "pa$$word".
+var mockUsers = map[int]*models.User{
+	1: {
+		ID:       1,
+		Name:     "Alice",
+		Email:    "alice@example.com",
+		Created:  time.Now(),
+		Verified: true,
+	},
+	2: {
+		ID:      2,
+		Name:    "Bob",
+		Email:   "bob@example.com",
+		Created: time.Now(),
+	},
+	3: {
+		ID:       3,
+		Name:     "Carol",
+		Email:    "carol@example.com",
+		Created:  time.Now(),
+		Verified: true,
+	},
+}
+
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 4, nil
 	}
 }
 
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+	user, err := m.GetByEmail(email)
+	if err == nil && password == "pa$$word" {
+		return user.ID, nil
 	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
-	switch id {
-	case 1:
-		return true, nil
-	default:
-		return false, nil
-	}
+	_, ok := mockUsers[id]
+	return ok, nil
 }
 
 func (m *UserModel) Get(id int) (*models.User, error) {
-	e, _ := m.Exists(id)
-
-	if !e {
+	user, ok := mockUsers[id]
+	if !ok {
 		return nil, models.ErrNoRecord
 	}
 
-	return &models.User{
-		ID:      1,
-		Name:    "Alice",
-		Email:   "alice@example.com",
-		Created: time.Now(),
-	}, nil
+	// hand out a copy so tests can't change the shared fixtures
+	u := *user
+	return &u, nil
 }
 
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
@@ -55,3 +74,43 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 	}
 	return models.ErrInvalidCredentials
 }
+
+func (m *UserModel) PasswordSet(id int, newPassword string) error {
+	return nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	for id, user := range mockUsers {
+		if user.Email == email {
+			return m.Get(id)
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *UserModel) Verify(id int, email string) error {
+	user, ok := mockUsers[id]
+	if !ok || user.Email != email {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Delete(id int, deleteSnippets bool) error {
+	if _, ok := mockUsers[id]; !ok {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Update(id int, name, email string) error {
+	if email == "dupe@example.com" {
+		return models.ErrDuplicateEmail
+	}
+	for otherID, user := range mockUsers {
+		if otherID != id && user.Email == email {
+			return models.ErrDuplicateEmail
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PasswordResetModel struct {
+	// used to store the one-time tokens emailed to users who forgot their
+	// password. Like API tokens only their hash is stored.
+	DB *sql.DB
+}
+
+type PasswordResetModelInterface interface {
+	Insert(userID int, ttl time.Duration) (string, error)
+	Exists(plaintext string) (bool, error)
+	Consume(plaintext string) (int, error)
+}
+
+// Creates a reset token for the user that expires after ttl, returning its
+// plaintext to be emailed
+func (m *PasswordResetModel) Insert(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO password_resets (hash, user_id, expires)
+	VALUES (?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, hashToken(plaintext), userID, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// checks whether the token exists and hasn't expired, without using it up
+func (m *PasswordResetModel) Exists(plaintext string) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP())`
+
+	err := m.DB.QueryRow(stmt, hashToken(plaintext)).Scan(&exists)
+	return exists, err
+}
+
+// Uses up a valid token, returning the ID of the user it was issued to. Every
+// other outstanding token of that user is discarded as well. Returns
+// ErrNoRecord for unknown, expired or already used tokens.
+func (m *PasswordResetModel) Consume(plaintext string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	// lock the row so two requests can't both use the same token
+	var userID int
+	stmt := `SELECT user_id FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+
+	err = tx.QueryRow(stmt, hashToken(plaintext)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestPasswordResetModelConsume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	t.Run("Used only once", func(t *testing.T) {
+		m := PasswordResetModel{newTestDB(t)}
+
+		plaintext, err := m.Insert(1, time.Hour)
+		assert.NilError(t, err)
+
+		userID, err := m.Consume(plaintext)
+		assert.NilError(t, err)
+		assert.Equal(t, userID, 1)
+
+		_, err = m.Consume(plaintext)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Other tokens of the user are discarded", func(t *testing.T) {
+		m := PasswordResetModel{newTestDB(t)}
+
+		first, err := m.Insert(1, time.Hour)
+		assert.NilError(t, err)
+		second, err := m.Insert(1, time.Hour)
+		assert.NilError(t, err)
+
+		_, err = m.Consume(second)
+		assert.NilError(t, err)
+
+		_, err = m.Consume(first)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		m := PasswordResetModel{newTestDB(t)}
+
+		plaintext, err := m.Insert(1, -time.Minute)
+		assert.NilError(t, err)
+
+		exists, err := m.Exists(plaintext)
+		assert.NilError(t, err)
+		assert.Equal(t, exists, false)
+
+		_, err = m.Consume(plaintext)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		m := PasswordResetModel{newTestDB(t)}
+
+		_, err := m.Consume("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+}
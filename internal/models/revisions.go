@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Type that holds a past or current version of a snippet. Revisions are
+// numbered from 1 for each snippet, the highest number being the current one
+type Revision struct {
+	Number   int
+	UserID   int
+	Author   string
+	Title    string
+	Content  string
+	Language string
+	Created  time.Time
+}
+
+// store the current title, content and language of a snippet as its next
+// revision, credited to the snippet's owner. The snippet row stays locked
+// until the transaction ends, so concurrent edits can't both pick the same
+// revision number
+func recordRevision(tx *sql.Tx, id int) error {
+	err := tx.QueryRow(`SELECT id FROM snippets WHERE id = ? FOR UPDATE`, id).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	statement := `INSERT INTO snippet_revisions (snippet_id, revision, user_id, title, content, language, created)
+	SELECT s.id, COALESCE((SELECT MAX(r.revision) FROM snippet_revisions r WHERE r.snippet_id = s.id), 0) + 1,
+		s.user_id, s.title, s.content, s.language, UTC_TIMESTAMP()
+	FROM snippets s WHERE s.id = ?`
+
+	_, err = tx.Exec(statement, id)
+	return err
+}
+
+// get every revision of a snippet, newest first. Callers must check that the
+// snippet itself may be seen first
+func (model *SnippetModel) Revisions(id int) ([]*Revision, error) {
+	statement := `SELECT r.revision, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.content, r.language, r.created
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? ORDER BY r.revision DESC`
+
+	rows, err := model.DB.Query(statement, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		revision := &Revision{}
+
+		err := rows.Scan(&revision.Number, &revision.UserID, &revision.Author, &revision.Title, &revision.Content,
+			&revision.Language, &revision.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// make an older revision of a snippet the current one again. The restored
+// version is recorded as a new revision, so nothing in the history is lost
+func (model *SnippetModel) Restore(id int, revision int) error {
+	tx, err := model.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	var title, content, language string
+
+	statement := `SELECT title, content, language FROM snippet_revisions WHERE snippet_id = ? AND revision = ?`
+
+	err = tx.QueryRow(statement, id, revision).Scan(&title, &content, &language)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE snippets SET title = ?, content = ?, language = ? WHERE id = ?`, title, content, language, id)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
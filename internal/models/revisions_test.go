@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestSnippetModelRevisions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+
+	id, _, err := m.Insert(1, "An old pond", "An old silent pond...", "", VisibilityPublic, "", time.Now().Add(time.Hour), 0)
+	assert.NilError(t, err)
+
+	err = m.Update(id, "An old silent pond", "An old silent pond...\nA frog jumps into the pond", "", VisibilityPublic)
+	assert.NilError(t, err)
+
+	revisions, err := m.Revisions(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(revisions), 2)
+
+	// newest first, credited to the owner
+	assert.Equal(t, revisions[0].Number, 2)
+	assert.Equal(t, revisions[0].Title, "An old silent pond")
+	assert.Equal(t, revisions[0].Author, "Alice Jones")
+	assert.Equal(t, revisions[1].Number, 1)
+	assert.Equal(t, revisions[1].Content, "An old silent pond...")
+
+	t.Run("Restore", func(t *testing.T) {
+		err := m.Restore(id, 1)
+		assert.NilError(t, err)
+
+		snippet, err := m.Get(id)
+		assert.NilError(t, err)
+		assert.Equal(t, snippet.Title, "An old pond")
+		assert.Equal(t, snippet.Content, "An old silent pond...")
+
+		// restoring adds to the history rather than rewinding it
+		revisions, err := m.Revisions(id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(revisions), 3)
+		assert.Equal(t, revisions[0].Number, 3)
+		assert.Equal(t, revisions[0].Title, "An old pond")
+	})
+
+	t.Run("Restore non-existent revision", func(t *testing.T) {
+		err := m.Restore(id, 9)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Deleted with the snippet", func(t *testing.T) {
+		err := m.Delete(id)
+		assert.NilError(t, err)
+
+		revisions, err := m.Revisions(id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(revisions), 0)
+	})
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+type Session struct {
+	// a logged in session. The session data itself lives in the sessions
+	// table managed by scs, this keeps track of whose it is and where it's
+	// used from so users can review and revoke their sessions.
+	ID        int
+	UserID    int
+	Token     string
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+type SessionModelInterface interface {
+	Insert(userID int, token, ip, userAgent string, expires time.Time) error
+	Touch(token, ip string) error
+	ForUser(userID int) ([]*Session, error)
+	Delete(id, userID int) (string, error)
+	DeleteOthers(userID int, token string) ([]string, error)
+	DeleteToken(token string) error
+	DeleteExpired(before time.Time, limit int) (int, error)
+}
+
+// Records that the user logged in with the given session token
+func (m *SessionModel) Insert(userID int, token, ip, userAgent string, expires time.Time) error {
+	stmt := `INSERT INTO user_sessions (user_id, token, ip, user_agent, created, last_seen, expires)
+	VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)`
+
+	_, err := m.DB.Exec(stmt, userID, token, ip, truncate(userAgent, 255), expires.UTC())
+	return err
+}
+
+// Records that the session was just used. Only writes once a minute per
+// session, callers should avoid calling it more often than that anyway.
+func (m *SessionModel) Touch(token, ip string) error {
+	stmt := `UPDATE user_sessions SET last_seen = UTC_TIMESTAMP(), ip = ?
+	WHERE token = ? AND last_seen < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE)`
+
+	_, err := m.DB.Exec(stmt, ip, token)
+	return err
+}
+
+// Lists the user's sessions that haven't expired, most recently used first
+func (m *SessionModel) ForUser(userID int) ([]*Session, error) {
+	stmt := `SELECT id, user_id, token, ip, user_agent, created, last_seen, expires FROM user_sessions
+	WHERE user_id = ? AND expires > UTC_TIMESTAMP() ORDER BY last_seen DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		s := &Session{}
+
+		err := rows.Scan(&s.ID, &s.UserID, &s.Token, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Forgets one of the user's sessions, returning its token so the session
+// data can be deleted too. Returns ErrNoRecord if the user has no session
+// with that ID.
+func (m *SessionModel) Delete(id, userID int) (string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var token string
+	err = tx.QueryRow(`SELECT token FROM user_sessions WHERE id = ? AND user_id = ? FOR UPDATE`, id, userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_sessions WHERE id = ?`, id)
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// Forgets every session of the user except the one with the given token,
+// returning their tokens. Pass an empty token to forget them all.
+func (m *SessionModel) DeleteOthers(userID int, token string) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT token FROM user_sessions WHERE user_id = ? AND token <> ? FOR UPDATE`, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_sessions WHERE user_id = ? AND token <> ?`, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// Forgets the session with the given token, e.g. when the user logs out
+func (m *SessionModel) DeleteToken(token string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE token = ?`, token)
+	return err
+}
+
+// Forgets at most limit sessions that expired before the given time, returning
+// how many were forgotten. Their session data is already gone by then.
+func (m *SessionModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM user_sessions WHERE expires < ? ORDER BY expires LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
+// cut s down to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestSessionModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SessionModel{newTestDB(t)}
+
+	now := time.Now()
+	tokens := []string{"expired-1", "expired-2", "expired-3"}
+	for i, token := range tokens {
+		err := m.Insert(1, token, "192.0.2.1", "", now.Add(-time.Duration(i+1)*time.Hour))
+		assert.NilError(t, err)
+	}
+	err := m.Insert(1, "current", "192.0.2.1", "", now.Add(time.Hour))
+	assert.NilError(t, err)
+
+	// deleted a batch at a time, until none are left
+	for _, want := range []int{2, 1, 0} {
+		deleted, err := m.DeleteExpired(now, 2)
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, want)
+	}
+
+	sessions, err := m.ForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].Token, "current")
+}
@@ -1,24 +1,153 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"errors"
+	"math/big"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userID int, title string, content string, language string, visibility string, password string, expires time.Time, views int) (int, string, error)
 	Get(id int) (*Snippet, error)
+	GetIncludingExpired(id int) (*Snippet, error)
+	GetBySlug(slug string) (*Snippet, error)
+	Unlock(id int, password string) error
+	View(id int) (*Snippet, error)
+	Extend(id int, expires time.Time) error
+	DeleteExpired(before time.Time, limit int) (int, error)
 	Latest() ([]*Snippet, error)
+	List(limit int, offset int) ([]*Snippet, error)
+	Count() (int, error)
+	Search(query string, limit int, offset int) ([]*Snippet, error)
+	CountSearch(query string) (int, error)
+	Update(id int, title string, content string, language string, visibility string) error
+	Delete(id int) error
+	Owner(id int) (int, error)
+	OwnerBySlug(slug string) (int, int, error)
+	ByUser(userID int, limit int, offset int) ([]*Snippet, error)
+	CountByUser(userID int) (int, error)
+	SetTags(id int, tags []string) error
+	ByTag(tag string, limit int, offset int) ([]*Snippet, error)
+	CountByTag(tag string) (int, error)
+	Revisions(id int) ([]*Revision, error)
+	Restore(id int, revision int) error
 }
 
+// Who can see a snippet. Public snippets are listed everywhere, unlisted ones
+// can only be reached by their link and private ones only by their owner.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 // Type that holds data of individual snippets
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	Slug       string
+	UserID     int
+	Author     string
+	Title      string
+	Content    string
+	Language   string
+	Visibility string
+	Protected  bool
+	ViewsLeft  int // how many more times the snippet may be viewed, 0 for no limit
+	Created    time.Time
+	Expires    time.Time // the zero time for snippets that never expire
+	Tags       []string
+}
+
+// Expired reports whether the snippet is past its expiry date
+func (s *Snippet) Expired() bool {
+	return !s.Expires.IsZero() && !s.Expires.After(time.Now())
+}
+
+// VisibleTo reports whether the user with the given ID, 0 for anonymous
+// visitors, may view the snippet. Only private snippets are restricted.
+func (s *Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != VisibilityPrivate || (userID != 0 && userID == s.UserID)
+}
+
+// Snippets are linked to by a random slug rather than their sequential ID, so
+// nobody can walk through every snippet by counting up
+const (
+	SlugLength   = 12
+	slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// generate a random base62 slug
+func newSlug() (string, error) {
+	slug := make([]byte, SlugLength)
+	base := big.NewInt(int64(len(slugAlphabet)))
+
+	for i := range slug {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		slug[i] = slugAlphabet[n.Int64()]
+	}
+
+	return string(slug), nil
+}
+
+// reports whether an insert failed because the generated slug was taken
+func isDuplicateSlug(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_slug")
+	}
+	return false
+}
+
+// columns selected by every query that returns whole snippets, in the order
+// scanSnippet() expects them. Snippets whose author has left have no user_id,
+// so the users table is always LEFT JOINed as u and both owner fields fall
+// back to their zero values. Tags are collected into a single comma separated
+// column, which is safe since tag names cannot contain commas.
+const snippetColumns = `s.id, s.slug, COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.title, s.content, s.language,
+	s.visibility, s.hashed_password IS NOT NULL, COALESCE(s.views_left, 0), s.created, s.expires, (SELECT GROUP_CONCAT(t.name ORDER BY t.name) FROM snippet_tags st JOIN tags t ON t.id = st.tag_id
+		WHERE st.snippet_id = s.id)`
+
+const snippetTables = `snippets s LEFT JOIN users u ON u.id = s.user_id`
+
+// condition selecting the snippets of s that haven't expired, snippets without
+// an expiry date never do
+const snippetUnexpired = `(s.expires IS NULL OR s.expires > UTC_TIMESTAMP())`
+
+// anything that can be scanned, i.e. *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// parse a row selected with snippetColumns into a snippet object
+func scanSnippet(row scanner) (*Snippet, error) {
+	snippet := &Snippet{}
+	var expires sql.NullTime
+	var tags sql.NullString
+
+	err := row.Scan(&snippet.ID, &snippet.Slug, &snippet.UserID, &snippet.Author, &snippet.Title, &snippet.Content,
+		&snippet.Language, &snippet.Visibility, &snippet.Protected, &snippet.ViewsLeft, &snippet.Created, &expires, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if expires.Valid {
+		snippet.Expires = expires.Time
+	}
+
+	if tags.Valid {
+		snippet.Tags = strings.Split(tags.String, ",")
+	}
+
+	return snippet, nil
 }
 
 // Model used to access snippet DB
@@ -26,41 +155,174 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// adding new snippet to DB returns its ID and possible error
-func (model *SnippetModel) Insert(title string, content string, expiry int) (int, error) {
-	statement := `INSERT INTO snippets (title, content, created, expires) 
-	VALUES (?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
-	result, err := model.DB.Exec(statement, title, content, expiry)
+// adding new snippet to DB on behalf of a user, returns its ID, slug and possible error.
+// A non-empty password protects the snippet, only its bcrypt hash is stored.
+// Snippets with a positive number of views are deleted once viewed that often,
+// and a zero expiry time means the snippet never expires
+func (model *SnippetModel) Insert(userID int, title string, content string, language string, visibility string, password string, expires time.Time, views int) (int, string, error) {
+	statement := `INSERT INTO snippets (slug, user_id, title, content, language, visibility, hashed_password, views_left, created, expires) 
+	VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), UTC_TIMESTAMP(), ?)`
+
+	var hashedPassword []byte
+	if password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return 0, "", err
+		}
+	}
 
+	tx, err := model.DB.Begin()
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	// a clash is astronomically unlikely, but try a fresh slug if it happens.
+	// A failed statement doesn't end the transaction, so it can be retried
+	for attempt := 0; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+
+		result, err := tx.Exec(statement, slug, userID, title, content, language, visibility, hashedPassword, views, nullTime(expires))
+		if err != nil {
+			if isDuplicateSlug(err) && attempt < 3 {
+				continue
+			}
+			return 0, "", err
+		}
+
+		// get resulting id
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+
+		// the snippet as created is its first revision
+		err = recordRevision(tx, int(id))
+		if err != nil {
+			return 0, "", err
+		}
 
-	// get resulting id
-	id, err := result.LastInsertId()
+		err = tx.Commit()
+		if err != nil {
+			return 0, "", err
+		}
+
+		return int(id), slug, nil
+	}
+}
+
+// move the expiry of a snippet, the zero time meaning it never expires
+func (model *SnippetModel) Extend(id int, expires time.Time) error {
+	statement := `UPDATE snippets SET expires = ? WHERE id = ?`
+
+	_, err := model.DB.Exec(statement, nullTime(expires), id)
+	return err
+}
+
+// store the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// change the title, content, language and visibility of an existing snippet,
+// recording the result as a new revision. Its expiry is left untouched
+func (model *SnippetModel) Update(id int, title string, content string, language string, visibility string) error {
+	tx, err := model.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	statement := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ? WHERE id = ?`
+
+	_, err = tx.Exec(statement, title, content, language, visibility, id)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// remove a snippet from the DB
+func (model *SnippetModel) Delete(id int) error {
+	statement := `DELETE FROM snippets WHERE id = ?`
+
+	_, err := model.DB.Exec(statement, id)
+	return err
+}
+
+// remove at most limit snippets that expired before the given time, returning
+// how many were removed. Snippets that never expire are left alone
+func (model *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	statement := `DELETE FROM snippets WHERE expires < ? ORDER BY expires LIMIT ?`
+
+	result, err := model.DB.Exec(statement, before, limit)
 	if err != nil {
 		return 0, err
 	}
 
-	return int(id), nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
 
+	return int(deleted), nil
 }
 
-// get specfic snippet by id
+// get specfic snippet by id, whatever its visibility. Callers showing it to
+// somebody must check Snippet.VisibleTo() first
 func (model *SnippetModel) Get(ID int) (*Snippet, error) {
-	statement := `SELECT title, content, created, expires FROM snippets 
-				WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				WHERE ` + snippetUnexpired + ` AND s.id = ?`
+
+	// parse values into a snippet object
+	snippet, err := scanSnippet(model.DB.QueryRow(statement, ID))
+
+	if err != nil {
+		// check for the no rows error specifically
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
 
-	row := model.DB.QueryRow(statement, ID)
+	return snippet, nil
+}
 
-	// parse values into vraibles to place into a snippet object
-	snippet := &Snippet{
-		ID: ID,
+// get specific snippet by id even if it has expired but hasn't been purged yet,
+// so its owner can still extend it. Callers must check the owner first
+func (model *SnippetModel) GetIncludingExpired(id int) (*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` WHERE s.id = ?`
+
+	snippet, err := scanSnippet(model.DB.QueryRow(statement, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
 	}
-	err := row.Scan(&snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
 
+	return snippet, nil
+}
+
+// get specific snippet by its slug, with the same rules as Get()
+func (model *SnippetModel) GetBySlug(slug string) (*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				WHERE ` + snippetUnexpired + ` AND s.slug = ?`
+
+	snippet, err := scanSnippet(model.DB.QueryRow(statement, slug))
 	if err != nil {
-		// check for the no rows error specifically
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		}
@@ -70,12 +332,191 @@ func (model *SnippetModel) Get(ID int) (*Snippet, error) {
 	return snippet, nil
 }
 
+// get a snippet for reading, counting the view against its limit. The row is
+// locked while the count goes down, so two readers can't both see a snippet
+// that may only be viewed once, and the view using up the limit deletes it.
+// The returned snippet holds the views left afterwards
+func (model *SnippetModel) View(id int) (*Snippet, error) {
+	tx, err := model.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+	WHERE ` + snippetUnexpired + ` AND s.id = ? FOR UPDATE OF s`
+
+	snippet, err := scanSnippet(tx.QueryRow(statement, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	switch snippet.ViewsLeft {
+	case 0:
+		// no limit, nothing to count
+	case 1:
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	default:
+		_, err = tx.Exec(`UPDATE snippets SET views_left = views_left - 1 WHERE id = ?`, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	if snippet.ViewsLeft > 0 {
+		snippet.ViewsLeft--
+	}
+
+	return snippet, nil
+}
+
+// check the password of a protected snippet, returning ErrInvalidCredentials
+// if it doesn't match or the snippet isn't protected at all
+func (model *SnippetModel) Unlock(id int, password string) error {
+	var hashedPassword []byte
+
+	statement := `SELECT hashed_password FROM snippets WHERE id = ?`
+
+	err := model.DB.QueryRow(statement, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if hashedPassword == nil {
+		return ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	return nil
+}
+
+// get the ID of the user who created a snippet, expired or not. Snippets
+// without an owner return 0
+func (model *SnippetModel) Owner(id int) (int, error) {
+	var userID int
+
+	statement := `SELECT COALESCE(user_id, 0) FROM snippets WHERE id = ?`
+
+	err := model.DB.QueryRow(statement, id).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// get the ID of a snippet, expired or not, and of the user who created it by
+// the snippet's slug. Snippets without an owner return 0 for the latter
+func (model *SnippetModel) OwnerBySlug(slug string) (int, int, error) {
+	var id, userID int
+
+	statement := `SELECT id, COALESCE(user_id, 0) FROM snippets WHERE slug = ?`
+
+	err := model.DB.QueryRow(statement, slug).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, ErrNoRecord
+		}
+		return 0, 0, err
+	}
+
+	return id, userID, nil
+}
+
 // get most recent snippets
 func (model *SnippetModel) Latest() ([]*Snippet, error) {
-	statement := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	return model.List(10, 0)
+}
+
+// get a page of unexpired public snippets, newest first
+func (model *SnippetModel) List(limit int, offset int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+	WHERE ` + snippetUnexpired + ` AND s.visibility = 'public' ORDER BY s.id DESC LIMIT ? OFFSET ?`
+
+	return model.query(statement, limit, offset)
+}
+
+// count every unexpired public snippet
+func (model *SnippetModel) Count() (int, error) {
+	var count int
+
+	statement := `SELECT COUNT(*) FROM snippets s WHERE ` + snippetUnexpired + ` AND s.visibility = 'public'`
+
+	err := model.DB.QueryRow(statement).Scan(&count)
+	return count, err
+}
+
+// get a page of unexpired public snippets whose title or content match the query,
+// most relevant first. Relies on the FULLTEXT index over (title, content).
+// Password protected and view limited snippets are left out, matching them
+// would leak their content
+func (model *SnippetModel) Search(query string, limit int, offset int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+	WHERE ` + snippetUnexpired + ` AND s.visibility = 'public' AND s.hashed_password IS NULL
+	AND s.views_left IS NULL AND MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)
+	ORDER BY MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, s.id DESC
+	LIMIT ? OFFSET ?`
+
+	return model.query(statement, query, query, limit, offset)
+}
+
+// count every unexpired public snippet matching a search query
+func (model *SnippetModel) CountSearch(query string) (int, error) {
+	var count int
+
+	statement := `SELECT COUNT(*) FROM snippets s
+	WHERE ` + snippetUnexpired + ` AND s.visibility = 'public' AND s.hashed_password IS NULL
+	AND s.views_left IS NULL AND MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE)`
+
+	err := model.DB.QueryRow(statement, query).Scan(&count)
+	return count, err
+}
+
+// get a page of the snippets created by a user, newest first. Unlike Latest()
+// expired, unlisted and private snippets are included, so owners can still see
+// and clean them up
+func (model *SnippetModel) ByUser(userID int, limit int, offset int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+	WHERE s.user_id = ? ORDER BY s.id DESC LIMIT ? OFFSET ?`
+
+	return model.query(statement, userID, limit, offset)
+}
+
+// count every snippet created by a user, expired and hidden ones included
+func (model *SnippetModel) CountByUser(userID int) (int, error) {
+	var count int
 
-	rows, err := model.DB.Query(statement)
+	statement := `SELECT COUNT(*) FROM snippets WHERE user_id = ?`
+
+	err := model.DB.QueryRow(statement, userID).Scan(&count)
+	return count, err
+}
+
+// run a statement selecting snippetColumns and collect every resulting snippet
+func (model *SnippetModel) query(statement string, args ...any) ([]*Snippet, error) {
+	rows, err := model.DB.Query(statement, args...)
 
 	if err != nil {
 		return nil, err
@@ -88,11 +529,7 @@ func (model *SnippetModel) Latest() ([]*Snippet, error) {
 
 	// iterate over rows
 	for rows.Next() {
-		// create place to hold an idvidual snippet
-		snippet := &Snippet{}
-
-		err := rows.Scan(&snippet.ID, &snippet.Title, &snippet.Content,
-			&snippet.Created, &snippet.Expires)
+		snippet, err := scanSnippet(rows)
 
 		if err != nil {
 			return nil, err
@@ -109,3 +546,54 @@ func (model *SnippetModel) Latest() ([]*Snippet, error) {
 	// all good? return snippets
 	return snippets, nil
 }
+
+// replace the tags of a snippet, creating any tag that doesn't exist yet
+func (model *SnippetModel) SetTags(id int, tags []string) error {
+	tx, err := model.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back after a commit is a no-op
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`INSERT IGNORE INTO tags (name) VALUES (?)`, tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?`, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// get a page of unexpired public snippets carrying a tag, newest first
+func (model *SnippetModel) ByTag(tag string, limit int, offset int) ([]*Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+	JOIN snippet_tags bt ON bt.snippet_id = s.id JOIN tags bn ON bn.id = bt.tag_id
+	WHERE ` + snippetUnexpired + ` AND s.visibility = 'public' AND bn.name = ? ORDER BY s.id DESC LIMIT ? OFFSET ?`
+
+	return model.query(statement, tag, limit, offset)
+}
+
+// count every unexpired public snippet carrying a tag
+func (model *SnippetModel) CountByTag(tag string) (int, error) {
+	var count int
+
+	statement := `SELECT COUNT(*) FROM snippets s
+	JOIN snippet_tags st ON st.snippet_id = s.id JOIN tags t ON t.id = st.tag_id
+	WHERE ` + snippetUnexpired + ` AND s.visibility = 'public' AND t.name = ?`
+
+	err := model.DB.QueryRow(statement, tag).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestSnippetModelView(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test.
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	expires := time.Now().Add(time.Hour)
+
+	t.Run("No limit", func(t *testing.T) {
+		m := SnippetModel{newTestDB(t)}
+
+		id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityPublic, "", expires, 0)
+		assert.NilError(t, err)
+
+		snippet, err := m.View(id)
+		assert.NilError(t, err)
+		assert.Equal(t, snippet.ViewsLeft, 0)
+
+		// nothing is counted, the snippet stays around
+		_, err = m.Get(id)
+		assert.NilError(t, err)
+	})
+
+	t.Run("Counts down", func(t *testing.T) {
+		m := SnippetModel{newTestDB(t)}
+
+		id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityPublic, "", expires, 3)
+		assert.NilError(t, err)
+
+		snippet, err := m.View(id)
+		assert.NilError(t, err)
+		assert.Equal(t, snippet.ViewsLeft, 2)
+		assert.Equal(t, snippet.Content, "An old silent pond...")
+
+		snippet, err = m.Get(id)
+		assert.NilError(t, err)
+		assert.Equal(t, snippet.ViewsLeft, 2)
+	})
+
+	t.Run("Burn after reading", func(t *testing.T) {
+		m := SnippetModel{newTestDB(t)}
+
+		id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityUnlisted, "", expires, 1)
+		assert.NilError(t, err)
+
+		// the only reader still gets to see the content
+		snippet, err := m.View(id)
+		assert.NilError(t, err)
+		assert.Equal(t, snippet.ViewsLeft, 0)
+		assert.Equal(t, snippet.Content, "An old silent pond...")
+
+		// but it is gone afterwards
+		_, err = m.Get(id)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		_, err = m.View(id)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		m := SnippetModel{newTestDB(t)}
+
+		id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityPublic, "", time.Now().Add(-time.Hour), 0)
+		assert.NilError(t, err)
+
+		_, err = m.View(id)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Non-existent ID", func(t *testing.T) {
+		m := SnippetModel{newTestDB(t)}
+
+		_, err := m.View(1)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+
+	insert := func(expires time.Time) int {
+		id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityPublic, "", expires, 0)
+		assert.NilError(t, err)
+		return id
+	}
+
+	now := time.Now()
+	var expired []int
+	for i := 1; i <= 3; i++ {
+		expired = append(expired, insert(now.Add(-time.Duration(i)*time.Hour)))
+	}
+	never := insert(time.Time{})
+	later := insert(now.Add(time.Hour))
+
+	// deleted a batch at a time, until none are left
+	for _, want := range []int{2, 1, 0} {
+		deleted, err := m.DeleteExpired(now, 2)
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, want)
+	}
+
+	for _, id := range expired {
+		_, err := m.Owner(id)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	}
+
+	// snippets that never expire or haven't yet are kept
+	for _, id := range []int{never, later} {
+		_, err := m.Owner(id)
+		assert.NilError(t, err)
+	}
+}
+
+func TestSnippetModelGetIncludingExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+
+	id, _, err := m.Insert(1, "An old silent pond", "An old silent pond...", "", VisibilityPublic, "", time.Now().Add(-time.Hour), 0)
+	assert.NilError(t, err)
+
+	_, err = m.Get(id)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	snippet, err := m.GetIncludingExpired(id)
+	assert.NilError(t, err)
+	assert.Equal(t, snippet.Expired(), true)
+
+	// extending it brings it back
+	err = m.Extend(id, time.Now().Add(time.Hour))
+	assert.NilError(t, err)
+
+	_, err = m.Get(id)
+	assert.NilError(t, err)
+
+	_, err = m.GetIncludingExpired(id + 1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
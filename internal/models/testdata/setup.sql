@@ -1,26 +1,137 @@
+CREATE TABLE users (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created DATETIME NOT NULL,
+    verified BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+
 CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug CHAR(12) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+    user_id INTEGER,
     title VARCHAR(100) NOT NULL,
     content TEXT NOT NULL,
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    hashed_password CHAR(60),
+    views_left INTEGER,
     created DATETIME NOT NULL,
-    expires DATETIME NOT NULL
+    expires DATETIME
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
 
-CREATE TABLE users (
+CREATE INDEX idx_snippets_expires ON snippets(expires);
+
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
+
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets(title, content);
+
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE TABLE snippet_revisions (
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    user_id INTEGER,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+ALTER TABLE snippet_revisions ADD CONSTRAINT snippet_revisions_fk_snippet_id FOREIGN KEY (snippet_id)
+    REFERENCES snippets(id) ON DELETE CASCADE;
+
+ALTER TABLE snippet_revisions ADD CONSTRAINT snippet_revisions_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE TABLE tags (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
-    name VARCHAR(255) NOT NULL,
-    email VARCHAR(255) NOT NULL,
-    hashed_password CHAR(60) NOT NULL,
+    name VARCHAR(30) NOT NULL
+);
+
+ALTER TABLE tags ADD CONSTRAINT tags_uc_name UNIQUE (name);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, tag_id)
+);
+
+ALTER TABLE snippet_tags ADD CONSTRAINT snippet_tags_fk_snippet_id FOREIGN KEY (snippet_id)
+    REFERENCES snippets(id) ON DELETE CASCADE;
+
+ALTER TABLE snippet_tags ADD CONSTRAINT snippet_tags_fk_tag_id FOREIGN KEY (tag_id)
+    REFERENCES tags(id) ON DELETE CASCADE;
+
+CREATE TABLE tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    hash BINARY(32) NOT NULL,
+    scope VARCHAR(20) NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME
+);
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_uc_hash UNIQUE (hash);
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE password_resets (
+    hash BINARY(32) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires DATETIME NOT NULL
+);
+
+ALTER TABLE password_resets ADD CONSTRAINT password_resets_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE two_factor (
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
     created DATETIME NOT NULL
 );
 
-ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
+ALTER TABLE two_factor ADD CONSTRAINT two_factor_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE recovery_codes (
+    user_id INTEGER NOT NULL,
+    hash BINARY(32) NOT NULL,
+    PRIMARY KEY (user_id, hash)
+);
+
+ALTER TABLE recovery_codes ADD CONSTRAINT recovery_codes_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE user_sessions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token CHAR(43) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    expires DATETIME NOT NULL
+);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_uc_token UNIQUE (token);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_fk_user_id FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE;
 
 INSERT INTO users (name, email, hashed_password, created) VALUES (
     'Alice Jones',
     'alice@example.com',
     '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
     '2022-01-01 10:00:00'
-);
\ No newline at end of file
+);
@@ -1,3 +1,19 @@
-DROP TABLE users;
+DROP TABLE user_sessions;
 
-DROP TABLE snippets;
\ No newline at end of file
+DROP TABLE recovery_codes;
+
+DROP TABLE two_factor;
+
+DROP TABLE password_resets;
+
+DROP TABLE tokens;
+
+DROP TABLE snippet_tags;
+
+DROP TABLE snippet_revisions;
+
+DROP TABLE tags;
+
+DROP TABLE snippets;
+
+DROP TABLE users;
\ No newline at end of file
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+// Scopes a token can be granted. Read-only tokens can only be used for
+// requests that don't change anything.
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+type Token struct {
+	// a personal API token, only its SHA-256 hash is kept in the database
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+type TokenModel struct {
+	// used to store and look up API tokens
+	DB *sql.DB
+}
+
+type TokenModelInterface interface {
+	Insert(userID int, name, scope string) (string, error)
+	Authenticate(plaintext string) (*Token, error)
+	ForUser(userID int) ([]*Token, error)
+	Delete(id, userID int) error
+}
+
+// generate 160 random bits encoded as 32 URL-safe characters
+func randomToken() (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
+// hash a plaintext token the way it is stored in the database
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// Creates a new token for the user and returns its plaintext, which is
+// shown to the user once and never stored
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	plaintext, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	plaintext = "sb_" + plaintext
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scope, created)
+	VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = m.DB.Exec(stmt, userID, name, hashToken(plaintext), scope)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Looks up the token matching the plaintext and records that it was used
+func (m *TokenModel) Authenticate(plaintext string) (*Token, error) {
+	hash := hashToken(plaintext)
+
+	stmt := `SELECT id, user_id, name, scope, created FROM tokens WHERE hash = ?`
+
+	token := &Token{}
+	err := m.DB.QueryRow(stmt, hash).Scan(&token.ID, &token.UserID, &token.Name, &token.Scope, &token.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	_, err = m.DB.Exec(`UPDATE tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Lists a user's tokens, newest first
+func (m *TokenModel) ForUser(userID int) ([]*Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+
+	for rows.Next() {
+		token := &Token{}
+		var lastUsed sql.NullTime
+
+		err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Scope, &token.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		token.LastUsed = lastUsed.Time
+
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revokes one of the user's tokens. Returns ErrNoRecord if the user has no
+// token with that ID.
+func (m *TokenModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestTokenModelAuthenticate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		m := TokenModel{newTestDB(t)}
+
+		plaintext, err := m.Insert(1, "laptop", ScopeReadWrite)
+		assert.NilError(t, err)
+
+		token, err := m.Authenticate(plaintext)
+		assert.NilError(t, err)
+		assert.Equal(t, token.UserID, 1)
+		assert.Equal(t, token.Name, "laptop")
+		assert.Equal(t, token.Scope, ScopeReadWrite)
+
+		// using it is recorded
+		tokens, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 1)
+		assert.Equal(t, tokens[0].LastUsed.IsZero(), false)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		m := TokenModel{newTestDB(t)}
+
+		_, err := m.Insert(1, "laptop", ScopeRead)
+		assert.NilError(t, err)
+
+		_, err = m.Authenticate("sb_AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Revoked token", func(t *testing.T) {
+		m := TokenModel{newTestDB(t)}
+
+		plaintext, err := m.Insert(1, "laptop", ScopeRead)
+		assert.NilError(t, err)
+
+		tokens, err := m.ForUser(1)
+		assert.NilError(t, err)
+
+		err = m.Delete(tokens[0].ID, 1)
+		assert.NilError(t, err)
+
+		_, err = m.Authenticate(plaintext)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+}
+
+func TestTokenModelDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := TokenModel{db}
+	users := UserModel{db}
+
+	bob, err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	_, err = m.Insert(1, "laptop", ScopeRead)
+	assert.NilError(t, err)
+
+	tokens, err := m.ForUser(1)
+	assert.NilError(t, err)
+	id := tokens[0].ID
+
+	t.Run("Someone else's token", func(t *testing.T) {
+		err := m.Delete(id, bob)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		tokens, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 1)
+	})
+
+	t.Run("Own token", func(t *testing.T) {
+		err := m.Delete(id, 1)
+		assert.NilError(t, err)
+
+		tokens, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 0)
+	})
+
+	t.Run("Already deleted", func(t *testing.T) {
+		err := m.Delete(id, 1)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+}
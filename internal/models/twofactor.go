@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// how many recovery codes a user gets when enabling two-factor authentication
+const recoveryCodeCount = 10
+
+type TwoFactor struct {
+	// a user's TOTP enrollment, the secret has to be kept in the clear since
+	// codes are generated from it. LastStep is the time step of the latest
+	// code accepted, codes from it or earlier ones can't be used again
+	UserID   int
+	Secret   string
+	LastStep int64
+	Created  time.Time
+}
+
+type TwoFactorModel struct {
+	// used to store TOTP secrets and the hashes of single-use recovery codes
+	DB *sql.DB
+}
+
+type TwoFactorModelInterface interface {
+	Get(userID int) (*TwoFactor, error)
+	Enable(userID int, secret string, step int64) ([]string, error)
+	Disable(userID int) error
+	UseStep(userID int, step int64) error
+	UseRecoveryCode(userID int, code string) error
+}
+
+// recovery codes are typed in by hand, so ignore case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// Returns the user's TOTP enrollment, or ErrNoRecord when they haven't
+// enabled two-factor authentication
+func (m *TwoFactorModel) Get(userID int) (*TwoFactor, error) {
+	stmt := `SELECT user_id, secret, last_step, created FROM two_factor WHERE user_id = ?`
+
+	tf := &TwoFactor{}
+	err := m.DB.QueryRow(stmt, userID).Scan(&tf.UserID, &tf.Secret, &tf.LastStep, &tf.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+// Turns on two-factor authentication with the confirmed secret, replacing
+// any earlier enrollment. The step of the code that confirmed it counts as
+// used. Returns a fresh set of recovery codes in plaintext to be shown to the
+// user once.
+func (m *TwoFactorModel) Enable(userID int, secret string, step int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		plaintext, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		// 10 characters (50 bits) are plenty for a single-use code
+		plaintext = strings.ToLower(plaintext[:10])
+		codes[i] = plaintext[:5] + "-" + plaintext[5:]
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO two_factor (user_id, secret, last_step, created) VALUES (?, ?, ?, UTC_TIMESTAMP())
+	ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_step = VALUES(last_step), created = VALUES(created)`
+
+	_, err = tx.Exec(stmt, userID, secret, step)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`,
+			userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// Turns off two-factor authentication and discards the recovery codes
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Records that a TOTP code from the given time step was accepted. Returns
+// ErrInvalidCredentials if a code from that step or a later one already was,
+// so every code works only once even when two logins race.
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	stmt := `UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`
+
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Uses up one of the user's recovery codes. Returns ErrInvalidCredentials if
+// the code doesn't match any unused one.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+
+	result, err := m.DB.Exec(stmt, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestTwoFactorModelUseStep(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := TwoFactorModel{newTestDB(t)}
+
+	// the code confirming the enrollment was from step 100
+	_, err := m.Enable(1, "JBSWY3DPEHPK3PXP", 100)
+	assert.NilError(t, err)
+
+	t.Run("Step of the enrollment", func(t *testing.T) {
+		err := m.UseStep(1, 100)
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Later step", func(t *testing.T) {
+		err := m.UseStep(1, 101)
+		assert.NilError(t, err)
+
+		tf, err := m.Get(1)
+		assert.NilError(t, err)
+		assert.Equal(t, tf.LastStep, int64(101))
+	})
+
+	t.Run("Same step twice", func(t *testing.T) {
+		err := m.UseStep(1, 101)
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Older step", func(t *testing.T) {
+		err := m.UseStep(1, 99)
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Not enrolled", func(t *testing.T) {
+		err := m.UseStep(2, 200)
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+}
+
+func TestTwoFactorModelUseRecoveryCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := TwoFactorModel{newTestDB(t)}
+
+	codes, err := m.Enable(1, "JBSWY3DPEHPK3PXP", 100)
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), recoveryCodeCount)
+
+	t.Run("Works once", func(t *testing.T) {
+		err := m.UseRecoveryCode(1, codes[0])
+		assert.NilError(t, err)
+
+		err = m.UseRecoveryCode(1, codes[0])
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Typed differently", func(t *testing.T) {
+		err := m.UseRecoveryCode(1, " "+strings.ToUpper(codes[1]))
+		assert.NilError(t, err)
+	})
+
+	t.Run("Unknown code", func(t *testing.T) {
+		err := m.UseRecoveryCode(1, "aaaaa-aaaaa")
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Replaced by a new enrollment", func(t *testing.T) {
+		_, err := m.Enable(1, "JBSWY3DPEHPK3PXP", 200)
+		assert.NilError(t, err)
+
+		err = m.UseRecoveryCode(1, codes[2])
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+}
@@ -17,6 +17,7 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Verified       bool
 }
 
 type UserModel struct {
@@ -25,38 +26,61 @@ type UserModel struct {
 }
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (*User, error)
 	PasswordUpdate(id int, currentPassword, newPassword string) error
+	PasswordSet(id int, newPassword string) error
+	GetByEmail(email string) (*User, error)
+	Verify(id int, email string) error
+	Delete(id int, deleteSnippets bool) error
+	Update(id int, name, email string) error
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	// inserts a new user into the database
+// bcrypt hash of a random password with the same cost as real ones, compared
+// against when no user has the email address so that it takes just as long
+// as checking a wrong password
+const dummyPasswordHash = "$2a$12$g3g5OqoB3Tr5QDGdfgTNoOwQjVGsBc/u20.ScLjTQmqJtVYFVrjkS"
+
+// checks if err was caused by inserting an email address that is already in
+// use
+func isDuplicateEmail(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email")
+	}
+	return false
+}
+
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	// inserts a new, unverified user into the database, returning their ID
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
     VALUES(?, ?, ?, UTC_TIMESTAMP())`
 
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	result, err := m.DB.Exec(stmt, name, email, string(hashedPassword))
 	if err != nil {
 
 		// check if the error is caused by the Email already existing
 		// if so return a specific error message.
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		if isDuplicateEmail(err) {
+			return 0, ErrDuplicateEmail
 		}
-		return err
+		return 0, err
 	}
-	return nil
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
 func (m *UserModel) Authenticate(email, password string) (int, error) {
@@ -69,6 +93,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	stmnt := "SELECT id, hashed_password FROM users WHERE email = ?"
 	err := m.DB.QueryRow(stmnt, email).Scan(&id, &hashedPassword)
 	if err != nil {
+		// an unknown email is just as wrong as a bad password, and takes as
+		// long to find out so it doesn't give away who has an account
+		if errors.Is(err, sql.ErrNoRows) {
+			bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+			return 0, ErrInvalidCredentials
+		}
 		return 0, err
 	}
 
@@ -111,7 +141,7 @@ func (m *UserModel) Get(id int) (*User, error) {
 	}
 
 	// User exists, retrieve information
-	stmt := "SELECT name, email, created FROM users WHERE id = ?"
+	stmt := "SELECT name, email, created, verified FROM users WHERE id = ?"
 
 	rw := m.DB.QueryRow(stmt, id)
 
@@ -119,7 +149,7 @@ func (m *UserModel) Get(id int) (*User, error) {
 		ID: id,
 	}
 
-	err = rw.Scan(&user.Name, &user.Email, &user.Created)
+	err = rw.Scan(&user.Name, &user.Email, &user.Created, &user.Verified)
 
 	if err != nil {
 		return nil, err
@@ -147,6 +177,12 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 		}
 	}
 
+	return m.PasswordSet(id, newPassword)
+}
+
+// Replaces a user's password without checking the current one, used once the
+// user has proven who they are some other way, e.g. with a reset token
+func (m *UserModel) PasswordSet(id int, newPassword string) error {
 	// hash new password
 	hashedNewPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
 	if err != nil {
@@ -154,7 +190,7 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 	}
 
 	// update DB
-	stmnt = "UPDATE users SET hashed_password = ? WHERE id = ?"
+	stmnt := "UPDATE users SET hashed_password = ? WHERE id = ?"
 	_, err = m.DB.Exec(stmnt, string(hashedNewPassword), id)
 	if err != nil {
 		return err
@@ -162,3 +198,104 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 
 	return nil
 }
+
+// Retreives information about an existing user by their email address
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := "SELECT id, name, email, created, verified FROM users WHERE email = ?"
+
+	user := User{}
+
+	err := m.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Verified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Marks the user's email address as confirmed. The address is checked too, so
+// a link sent to an old address can't confirm a newer one. Returns
+// ErrNoRecord if the user no longer has that address.
+func (m *UserModel) Verify(id int, email string) error {
+	stmt := "UPDATE users SET verified = TRUE WHERE id = ? AND email = ?"
+
+	_, err := m.DB.Exec(stmt, id, email)
+	if err != nil {
+		return err
+	}
+
+	// RowsAffected is 0 for already verified users too, so check separately
+	var exists bool
+	stmt = "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND email = ?)"
+
+	err = m.DB.QueryRow(stmt, id, email).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Removes the user along with their tokens and sessions. Their snippets are
+// deleted too if deleteSnippets is set, otherwise they are kept without an
+// author. Private and password protected snippets are always deleted, since
+// without an owner nobody could see, change or delete them any more.
+func (m *UserModel) Delete(id int, deleteSnippets bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := "DELETE FROM snippets WHERE user_id = ? AND (visibility = ? OR hashed_password IS NOT NULL)"
+	if deleteSnippets {
+		stmt = "DELETE FROM snippets WHERE user_id = ?"
+	}
+
+	_, err = tx.Exec(stmt, id, VisibilityPrivate)
+	if err != nil {
+		return err
+	}
+
+	// everything else belonging to the user goes with it through ON DELETE
+	// CASCADE, and the remaining snippets lose their author through ON
+	// DELETE SET NULL
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit()
+}
+
+// Changes the user's name and email address. A new address has to be
+// verified again. Returns ErrDuplicateEmail if another user has the address.
+func (m *UserModel) Update(id int, name, email string) error {
+	// SET assigns left to right, so verified is compared to the old address
+	stmt := `UPDATE users SET name = ?, verified = verified AND email = ?, email = ?
+	WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, name, email, email, id)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return nil
+}
@@ -1,11 +1,21 @@
 package models
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"snippetbox.opre.net/internal/assert"
 )
 
+func TestDummyPasswordHash(t *testing.T) {
+	// it has to cost as much to check as the hashes Insert() creates
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	assert.NilError(t, err)
+	assert.Equal(t, cost, 12)
+}
+
 func TestUserModelExists(t *testing.T) {
 	// Skip the test if the "-short" flag is provided when running the test.
 	if testing.Short() {
@@ -53,3 +63,124 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	insert := func(t *testing.T, snippets *SnippetModel, visibility, password string) int {
+		id, _, err := snippets.Insert(1, "An old silent pond", "An old silent pond...", "", visibility, password, time.Now().Add(time.Hour), 0)
+		assert.NilError(t, err)
+		return id
+	}
+
+	t.Run("Keep snippets", func(t *testing.T) {
+		db := newTestDB(t)
+		m := UserModel{db}
+		snippets := &SnippetModel{db}
+
+		public := insert(t, snippets, VisibilityPublic, "")
+		unlisted := insert(t, snippets, VisibilityUnlisted, "")
+		private := insert(t, snippets, VisibilityPrivate, "")
+		protected := insert(t, snippets, VisibilityPublic, "secret")
+
+		err := m.Delete(1, false)
+		assert.NilError(t, err)
+
+		// public and unlisted snippets stay, without an author
+		for _, id := range []int{public, unlisted} {
+			snippet, err := snippets.Get(id)
+			assert.NilError(t, err)
+			assert.Equal(t, snippet.UserID, 0)
+			assert.Equal(t, snippet.Author, "")
+		}
+
+		// nobody could get at the others any more
+		for _, id := range []int{private, protected} {
+			_, err := snippets.Get(id)
+			assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+		}
+
+		exists, err := m.Exists(1)
+		assert.NilError(t, err)
+		assert.Equal(t, exists, false)
+	})
+
+	t.Run("Delete snippets", func(t *testing.T) {
+		db := newTestDB(t)
+		m := UserModel{db}
+		snippets := &SnippetModel{db}
+
+		public := insert(t, snippets, VisibilityPublic, "")
+
+		err := m.Delete(1, true)
+		assert.NilError(t, err)
+
+		_, err = snippets.Get(public)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Non-existent ID", func(t *testing.T) {
+		m := UserModel{newTestDB(t)}
+
+		err := m.Delete(2, false)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+}
+
+func TestUserModelUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	tests := []struct {
+		name         string
+		email        string
+		wantVerified bool
+	}{
+		{
+			name:         "Same email",
+			email:        "alice@example.com",
+			wantVerified: true,
+		},
+		{
+			name:         "Same email in other case",
+			email:        "Alice@Example.com",
+			wantVerified: true,
+		},
+		{
+			name:         "Changed email",
+			email:        "alice@new.example.com",
+			wantVerified: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := UserModel{newTestDB(t)}
+
+			err := m.Verify(1, "alice@example.com")
+			assert.NilError(t, err)
+
+			err = m.Update(1, "Alice", tt.email)
+			assert.NilError(t, err)
+
+			user, err := m.Get(1)
+			assert.NilError(t, err)
+			assert.Equal(t, user.Name, "Alice")
+			assert.Equal(t, user.Email, tt.email)
+			assert.Equal(t, user.Verified, tt.wantVerified)
+		})
+	}
+
+	t.Run("Email of another user", func(t *testing.T) {
+		m := UserModel{newTestDB(t)}
+
+		_, err := m.Insert("Bob", "bob@example.com", "pa$$word")
+		assert.NilError(t, err)
+
+		err = m.Update(1, "Alice", "bob@example.com")
+		assert.Equal(t, errors.Is(err, ErrDuplicateEmail), true)
+	})
+}
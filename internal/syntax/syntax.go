@@ -0,0 +1,167 @@
+package syntax
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Languages lists the lexer names a snippet can be highlighted as, in the
+// order they are offered on the create form. An empty language means plain
+// text.
+var Languages = []string{
+	"bash", "c", "cpp", "csharp", "css", "diff", "docker", "go", "html", "java",
+	"javascript", "json", "kotlin", "make", "markdown", "php", "python", "ruby",
+	"rust", "sql", "swift", "toml", "typescript", "yaml",
+}
+
+// The HTML is rendered with CSS classes rather than inline styles, since the
+// Content-Security-Policy forbids inline styles. The matching stylesheet lives
+// in ui/static/css/syntax.css. Line numbers are kept in their own table column
+// so they aren't picked up when copying the code.
+var (
+	style     = styles.Get("github")
+	formatter = html.New(
+		html.WithClasses(true),
+		html.WithLineNumbers(true),
+		html.LineNumbersInTable(true),
+		html.TabWidth(4),
+	)
+)
+
+// a few cheap checks for the most common snippets, chroma's own analysers
+// only cover a handful of languages
+var (
+	shebangRX = regexp.MustCompile(`^#!\s*(\S+)(?:[ \t]+(\S+))?`)
+	goRX      = regexp.MustCompile(`(?m)^package \w+\s*$`)
+	phpRX     = regexp.MustCompile(`^<\?php`)
+	htmlRX    = regexp.MustCompile(`(?i)^<(?:!doctype html|html)`)
+	diffRX    = regexp.MustCompile(`(?m)^(?:diff --git |--- \S.*\n\+\+\+ \S)`)
+	dockerRX  = regexp.MustCompile(`(?i)^FROM \S+`)
+)
+
+var interpreters = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "bash",
+	"python":  "python",
+	"python3": "python",
+	"ruby":    "ruby",
+	"node":    "javascript",
+	"php":     "php",
+}
+
+// Supported reports whether language is one of Languages or blank
+func Supported(language string) bool {
+	if language == "" {
+		return true
+	}
+
+	for _, l := range Languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the human readable name of a language, e.g. "C++" for "cpp"
+func Name(language string) string {
+	if language == "" {
+		return "Plain text"
+	}
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return language
+	}
+	return lexer.Config().Name
+}
+
+// Extension returns the usual file extension for a language, including the
+// leading dot, or ".txt" for plain text and languages without one
+func Extension(language string) string {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		return ".txt"
+	}
+
+	for _, pattern := range lexer.Config().Filenames {
+		ext, ok := strings.CutPrefix(pattern, "*.")
+		if ok && !strings.ContainsAny(ext, "*?[") {
+			return "." + ext
+		}
+	}
+	return ".txt"
+}
+
+// Detect guesses the language of content, returning one of Languages or the
+// empty string when no supported language is recognized
+func Detect(content string) string {
+	trimmed := strings.TrimSpace(content)
+
+	// "#!/bin/sh" or "#!/usr/bin/env python3"
+	if m := shebangRX.FindStringSubmatch(trimmed); m != nil {
+		interpreter := path.Base(m[1])
+		if interpreter == "env" {
+			interpreter = m[2]
+		}
+		return interpreters[interpreter]
+	}
+
+	switch {
+	case phpRX.MatchString(trimmed):
+		return "php"
+	case htmlRX.MatchString(trimmed):
+		return "html"
+	case dockerRX.MatchString(trimmed):
+		return "docker"
+	case diffRX.MatchString(trimmed):
+		return "diff"
+	case goRX.MatchString(trimmed):
+		return "go"
+	case (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)):
+		return "json"
+	}
+
+	if lexer := lexers.Analyse(content); lexer != nil {
+		for _, alias := range lexer.Config().Aliases {
+			if alias != "" && Supported(alias) {
+				return alias
+			}
+		}
+	}
+
+	return ""
+}
+
+// Render highlights content as language and returns it as a table of line
+// numbers and code, ready to be placed in a template
+func Render(content, language string) (template.HTML, error) {
+	lexer := lexers.Get(language)
+	if language == "" || lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, style, iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
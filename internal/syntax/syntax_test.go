@@ -0,0 +1,98 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+
+	"snippetbox.opre.net/internal/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "Go",
+			content: "package main\n\nfunc main() {}\n",
+			want:    "go",
+		},
+		{
+			name:    "Shell shebang",
+			content: "#!/bin/sh\necho hello\n",
+			want:    "bash",
+		},
+		{
+			name:    "Env shebang",
+			content: "#!/usr/bin/env python3\nprint('hello')\n",
+			want:    "python",
+		},
+		{
+			name:    "JSON",
+			content: `{"title": "An old silent pond"}`,
+			want:    "json",
+		},
+		{
+			name:    "Diff",
+			content: "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n",
+			want:    "diff",
+		},
+		{
+			name:    "Dockerfile",
+			content: "FROM golang:1.21\nRUN go build ./...\n",
+			want:    "docker",
+		},
+		{
+			name:    "Plain text",
+			content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.content), tt.want)
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	assert.Equal(t, Supported(""), true)
+	assert.Equal(t, Supported("go"), true)
+	assert.Equal(t, Supported("brainfuck"), false)
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, Extension("go"), ".go")
+	assert.Equal(t, Extension("python"), ".py")
+	assert.Equal(t, Extension("bash"), ".sh")
+	assert.Equal(t, Extension(""), ".txt")
+	// extensions are case sensitive, e.g. "build.Dockerfile"
+	assert.Equal(t, Extension("docker"), ".Dockerfile")
+}
+
+func TestRender(t *testing.T) {
+	t.Run("Highlights with classes", func(t *testing.T) {
+		out, err := Render("package main\n", "go")
+
+		assert.NilError(t, err)
+		assert.StringContains(t, string(out), `<span class="kn">package</span>`)
+		// the CSP doesn't allow inline styles
+		assert.Equal(t, strings.Contains(string(out), "style="), false)
+	})
+
+	t.Run("Numbers lines", func(t *testing.T) {
+		out, err := Render("one\ntwo\n", "")
+
+		assert.NilError(t, err)
+		assert.StringContains(t, string(out), `<span class="lnt">2`)
+	})
+
+	t.Run("Escapes HTML", func(t *testing.T) {
+		out, err := Render("<script>alert(1)</script>", "")
+
+		assert.NilError(t, err)
+		assert.Equal(t, strings.Contains(string(out), "<script>"), false)
+	})
+}
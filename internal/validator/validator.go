@@ -13,6 +13,10 @@ import (
 // variable is more performant than re-parsing the pattern each time we need it.
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// TagRX matches a single snippet tag: lowercase letters, digits and a few
+// punctuation characters common in language names (e.g. "c++", "node.js").
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+._-]*$`)
+
 // Define a new Validator type which contains a map of validation errors for our
 // form fields.
 type Validator struct {